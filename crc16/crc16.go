@@ -1,7 +1,8 @@
 package crc16
 
-// CRC 16 Modbus pre-calculated table
-var table = []uint16{
+// CRC 16 Modbus (polynomial 0xA001) pre-calculated table. As an array indexed
+// by a byte, lookups need no bounds check.
+var table = [256]uint16{
 	0x0000, 0xC0C1, 0xC181, 0x0140, 0xC301, 0x03C0, 0x0280, 0xC241,
 	0xC601, 0x06C0, 0x0780, 0xC741, 0x0500, 0xC5C1, 0xC481, 0x0440,
 	0xCC01, 0x0CC0, 0x0D80, 0xCD41, 0x0F00, 0xCFC1, 0xCE81, 0x0E40,
@@ -0,0 +1,51 @@
+package crc16
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// bitwise is the reference CRC 16 Modbus, reflected polynomial 0xA001
+func bitwise(data []uint8) uint16 {
+	crc := uint16(0xFFFF)
+	for _, v := range data {
+		crc ^= uint16(v)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
+
+func TestCRCKnownFrame(t *testing.T) {
+	// Read of the 10 input registers, sent as ... 70 0D
+	if crc := CRC([]uint8{0x01, 0x04, 0x00, 0x00, 0x00, 0x0A}); crc != 0x0D70 {
+		t.Errorf("CRC = 0x%.4x, want 0x0D70", crc)
+	}
+}
+
+func TestCRCMatchesBitwise(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		data := make([]uint8, r.Intn(64))
+		r.Read(data)
+		if got, want := CRC(data), bitwise(data); got != want {
+			t.Fatalf("CRC(% x) = 0x%.4x, bitwise gives 0x%.4x", data, got, want)
+		}
+	}
+}
+
+func FuzzCRC(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{0x01, 0x04, 0x00, 0x00, 0x00, 0x0A})
+	f.Add([]byte{0xF8, 0x42})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if got, want := CRC(data), bitwise(data); got != want {
+			t.Errorf("CRC(% x) = 0x%.4x, bitwise gives 0x%.4x", data, got, want)
+		}
+	})
+}
@@ -1,9 +1,9 @@
 module github.com/be-ys/pzem-004t-v3
 
-go 1.12
+go 1.13
 
 require (
-	github.com/go-errors/errors v1.0.1
+	github.com/prometheus/client_golang v1.17.0
 	github.com/tarm/serial v0.0.0-20180830185346-98f6abe2eb07
-	golang.org/x/sys v0.0.0-20191029155521-f43be2a4598c // indirect
+	golang.org/x/sys v0.15.0 // indirect
 )
@@ -8,15 +8,6 @@ import (
 	"github.com/be-ys/pzem-004t-v3/pzem"
 )
 
-const toPrint = `
-Voltage: %f
-Intensity: %f
-Power: %f
-Frequency: %f
-Energy: %f
-PowerFactor: %f
-`
-
 func main() {
 	p, err := pzem.Setup(
 		pzem.Config{
@@ -35,30 +26,10 @@ func main() {
 	t := time.NewTicker(1 * time.Second)
 	for {
 		<-t.C
-		voltage, err := p.Voltage()
-		if err != nil {
-			panic(err)
-		}
-		intensity, err := p.Intensity()
-		if err != nil {
-			panic(err)
-		}
-		power, err := p.Power()
-		if err != nil {
-			panic(err)
-		}
-		frequency, err := p.Frequency()
-		if err != nil {
-			panic(err)
-		}
-		energy, err := p.Energy()
-		if err != nil {
-			panic(err)
-		}
-		powerFactor, err := p.PowerFactor()
+		m, err := p.ReadAll()
 		if err != nil {
 			panic(err)
 		}
-		fmt.Printf(toPrint, voltage, intensity, power, frequency, energy, powerFactor)
+		fmt.Println(m)
 	}
 }
@@ -0,0 +1,98 @@
+package pzem_test
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/be-ys/pzem-004t-v3/pzem"
+	"github.com/be-ys/pzem-004t-v3/pzem/pzemtest"
+)
+
+// line is an RS485 line shared by several fake devices: every request
+// reaches them all, and the reply of the one answering is read back
+type line []*pzemtest.FakeDevice
+
+func (l line) Write(b []byte) (int, error) {
+	for _, d := range l {
+		if _, err := d.Write(b); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+func (l line) Read(b []byte) (int, error) {
+	for _, d := range l {
+		if n, err := d.Read(b); n > 0 || err != io.EOF {
+			return n, err
+		}
+	}
+	return 0, io.EOF
+}
+
+func (l line) Close() error { return nil }
+
+// fakeAt returns a fake device reporting m, moved to addr
+func fakeAt(t *testing.T, addr uint8, m pzem.Measurement) *pzemtest.FakeDevice {
+	t.Helper()
+
+	d := pzemtest.NewFakeDevice(m)
+	if _, err := d.Write(pzem.BuildReadFrame(pzemtest.DefaultAddress, pzem.WriteSingleRegister, pzem.ModbusRTUAddress, uint16(addr))); err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, d) // Drop the echo
+	if d.Address() != addr {
+		t.Fatalf("fake device at 0x%.2x, want 0x%.2x", d.Address(), addr)
+	}
+	return d
+}
+
+func TestSetAddressRefused(t *testing.T) {
+	a := pzemtest.NewFakeDevice(pzem.Measurement{Voltage: 230})
+	b := fakeAt(t, 0x05, pzem.Measurement{Voltage: 111})
+	p, err := pzem.SetupWithTransport(line{a, b}, pzem.Config{SlaveArddress: 0x01, UpdateInterval: time.Nanosecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a.InjectException(0x03)
+	if err := p.SetAddress(0x05); !errors.Is(err, pzem.ErrIllegalData) {
+		t.Fatalf("SetAddress() refused by the device = %v, want ErrIllegalData", err)
+	}
+
+	// The probe must still read device A, not B already at 0x05
+	if v, err := p.Voltage(); err != nil || v != 230 {
+		t.Errorf("Voltage() = %v, %v, want 230 from the device at 0x01", v, err)
+	}
+}
+
+func TestWriteRegisterAddress(t *testing.T) {
+	p, d := setupFake(t, pzem.Measurement{Voltage: 230})
+	if _, err := p.Voltage(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, addr := range []uint16{0x00, 0xF8, 0x105} {
+		if err := p.WriteRegister(pzem.ModbusRTUAddress, addr); err == nil {
+			t.Errorf("WriteRegister(ModbusRTUAddress, 0x%.2x) succeeded", addr)
+		}
+	}
+
+	if err := p.WriteRegister(pzem.ModbusRTUAddress, 0x05); err != nil {
+		t.Fatal(err)
+	}
+	if d.Address() != 0x05 {
+		t.Fatalf("device at 0x%.2x, want 0x05", d.Address())
+	}
+	if err := p.Ping(); err != nil {
+		t.Errorf("Ping() after the address write = %v", err)
+	}
+
+	// The cached reading must not outlive the change
+	d.SetMeasurement(pzem.Measurement{Voltage: 231})
+	if v, err := p.Voltage(); err != nil || v != 231 {
+		t.Errorf("Voltage() after the address write = %v, %v, want 231", v, err)
+	}
+}
@@ -0,0 +1,76 @@
+package pzem
+
+import "math"
+
+const (
+	// PzemDefaultNominalVoltage is the nominal voltage used when none is set
+	PzemDefaultNominalVoltage = 230.0
+	// PzemDefaultVoltageTolerance is the relative tolerance used when none is set
+	PzemDefaultVoltageTolerance = 0.1
+)
+
+// VoltageClass classifies a voltage against the nominal one
+type VoltageClass int
+
+const (
+	// VoltageNormal is within tolerance
+	VoltageNormal VoltageClass = iota
+	// VoltageSag is below tolerance
+	VoltageSag
+	// VoltageSwell is above tolerance
+	VoltageSwell
+	// VoltageSevere is more than twice the tolerance away, either way
+	VoltageSevere
+)
+
+func (c VoltageClass) String() string {
+	switch c {
+	case VoltageNormal:
+		return "normal"
+	case VoltageSag:
+		return "sag"
+	case VoltageSwell:
+		return "swell"
+	case VoltageSevere:
+		return "severe"
+	default:
+		return "unknown"
+	}
+}
+
+// AnomalyReport is the classification of a voltage reading
+type AnomalyReport struct {
+	Voltage float32
+	Nominal float32
+	// Deviation relative to the nominal voltage, negative below it
+	Deviation float32
+	Class     VoltageClass
+}
+
+// VoltageAnomaly reads the voltage and classifies it against the configured
+// nominal voltage and tolerance
+func (p *pzem) VoltageAnomaly() (AnomalyReport, error) {
+	v, err := p.Voltage()
+	if err != nil {
+		return AnomalyReport{}, err
+	}
+
+	r := AnomalyReport{
+		Voltage:   v,
+		Nominal:   p.nominal,
+		Deviation: (v - p.nominal) / p.nominal,
+	}
+
+	switch dev := math.Abs(float64(r.Deviation)); {
+	case dev > 2*float64(p.tolerance):
+		r.Class = VoltageSevere
+	case dev <= float64(p.tolerance):
+		r.Class = VoltageNormal
+	case r.Deviation < 0:
+		r.Class = VoltageSag
+	default:
+		r.Class = VoltageSwell
+	}
+
+	return r, nil
+}
@@ -0,0 +1,147 @@
+package pzem
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Bus shares a single transport between several devices with different
+// addresses, e.g. meters daisy-chained on one RS485 adapter. Devices get the
+// line in the order they asked for it, so a device polled often cannot
+// starve the others.
+type Bus struct {
+	mu      sync.Mutex // Protects devices
+	line    fairLock   // Held for the whole duration of a transaction
+	port    io.ReadWriteCloser
+	config  Config
+	devices []*pzem   // Returned by Device, in order
+	lastTx  time.Time // Start of the last transaction on the bus, under line
+}
+
+// NewBus creates a bus over the given transport. config applies to every
+// device of the bus, SlaveArddress excepted. The bus owns the transport and
+// closes it on Close().
+func NewBus(rw io.ReadWriteCloser, config Config) (*Bus, error) {
+	if rw == nil {
+		return nil, fmt.Errorf("transport must be set: %w", ErrNotConnected)
+	}
+	if err := config.check(); err != nil {
+		return nil, err
+	}
+	return &Bus{port: rw, config: config}, nil
+}
+
+// Device returns a Probe for the device at the given address. Transactions
+// of all the devices of the bus are serialized, while each one keeps its own
+// cache. It fails on an address out of the 0x01-0xF7 range, other than the
+// general address; a device not answering fails on first use instead.
+func (b *Bus) Device(addr uint8) (Probe, error) {
+	if err := checkAddress(addr); err != nil {
+		return nil, err
+	}
+
+	config := b.config
+	config.SlaveArddress = addr
+	p, _ := newProbe(sharedPort{b.port}, config, b) // A device not answering fails again on first use
+
+	b.mu.Lock()
+	b.devices = append(b.devices, p)
+	b.mu.Unlock()
+
+	return p, nil
+}
+
+// ReadAll reads every device returned by Device, one after the other, and
+// returns a Reading for each, in order. A device failing does not stop the
+// others from being read. Once ctx is done, the devices left get its error.
+func (b *Bus) ReadAll(ctx context.Context) []Reading {
+	b.mu.Lock()
+	devices := append([]*pzem(nil), b.devices...)
+	b.mu.Unlock()
+
+	readings := make([]Reading, len(devices))
+	for i, p := range devices {
+		m, err := p.ReadAllContext(ctx)
+
+		p.mu.Lock()
+		addr := p.addr
+		p.mu.Unlock()
+
+		readings[i] = Reading{Address: addr, Measurement: m, Time: time.Now(), Err: err}
+	}
+	return readings
+}
+
+// Close closes the transport. Devices of the bus can no longer be used.
+func (b *Bus) Close() error {
+	b.line.Lock()
+	defer b.line.Unlock()
+
+	return b.port.Close()
+}
+
+// acquire blocks until the probe may use the line: MinTransactionInterval
+// elapsed since the previous transaction on the line, a transaction slot is
+// available and, for a device on a bus, no other device of the bus is in a
+// transaction. It returns the function releasing both.
+func (p *pzem) acquire() func() {
+	if p.bus == nil {
+		p.lastTx = p.waitGap(p.lastTx) // Before the slot, not to hold it while waiting
+		return acquireSlot()
+	}
+
+	release := acquireSlot()
+	p.bus.line.Lock()
+	p.bus.lastTx = p.waitGap(p.bus.lastTx)
+	return func() {
+		p.bus.line.Unlock()
+		release()
+	}
+}
+
+// waitGap sleeps until MinTransactionInterval elapsed since last, and returns
+// the start of the new transaction
+func (p *pzem) waitGap(last time.Time) time.Time {
+	if d := time.Until(last.Add(p.minGap)); d > 0 {
+		time.Sleep(d)
+	}
+	return time.Now()
+}
+
+// fairLock is a mutex granting the lock in the order it was asked for,
+// unlike sync.Mutex
+type fairLock struct {
+	mu      sync.Mutex
+	held    bool
+	waiting []chan struct{} // Closed to hand the lock over, in order
+}
+
+func (l *fairLock) Lock() {
+	l.mu.Lock()
+	if !l.held {
+		l.held = true
+		l.mu.Unlock()
+		return
+	}
+	ch := make(chan struct{})
+	l.waiting = append(l.waiting, ch)
+	l.mu.Unlock()
+
+	<-ch
+}
+
+// Unlock hands the lock over to the first waiter, if any
+func (l *fairLock) Unlock() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.waiting) == 0 {
+		l.held = false
+		return
+	}
+	close(l.waiting[0])
+	l.waiting = l.waiting[1:]
+}
@@ -0,0 +1,34 @@
+package pzem_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/be-ys/pzem-004t-v3/pzem"
+	"github.com/be-ys/pzem-004t-v3/pzem/pzemtest"
+)
+
+func TestBusDeviceAddress(t *testing.T) {
+	d := pzemtest.NewFakeDevice(pzem.Measurement{Voltage: 230})
+	b, err := pzem.NewBus(d, pzem.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, addr := range []uint8{0x00, 0xF9, 0xFF} {
+		if p, err := b.Device(addr); err == nil || p != nil {
+			t.Errorf("Device(0x%.2x) = %v, %v, want an error", addr, p, err)
+		}
+	}
+	if got := b.ReadAll(context.Background()); len(got) != 0 {
+		t.Errorf("ReadAll() read %d devices, want none", len(got))
+	}
+
+	p, err := b.Device(0x01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := p.Voltage(); err != nil || v != 230 {
+		t.Errorf("Voltage() = %v, %v, want 230", v, err)
+	}
+}
@@ -0,0 +1,64 @@
+package pzem_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/be-ys/pzem-004t-v3/pzem"
+)
+
+func TestCloseStopsBackgroundGoroutines(t *testing.T) {
+	p, _ := setupFake(t, pzem.Measurement{Voltage: 230})
+	ctx := context.Background()
+
+	readings := p.Stream(ctx, time.Millisecond)
+	alarms, err := p.WatchAlarm(ctx, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	states, err := p.StartWatchdog(ctx, time.Millisecond, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-readings // The stream is running
+
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Close waited for the goroutines, their channels are closed by now
+	timeout := time.After(time.Second)
+	for readings != nil || alarms != nil || states != nil {
+		select {
+		case _, ok := <-readings:
+			if ok {
+				t.Fatal("Stream still running after Close")
+			}
+			readings = nil
+		case _, ok := <-alarms:
+			if ok {
+				t.Fatal("WatchAlarm still running after Close")
+			}
+			alarms = nil
+		case _, ok := <-states:
+			if ok {
+				t.Fatal("StartWatchdog still running after Close")
+			}
+			states = nil
+		case <-timeout:
+			t.Fatal("channels not closed after Close")
+		}
+	}
+
+	if _, ok := <-p.Stream(ctx, time.Millisecond); ok {
+		t.Error("Stream on a closed probe sent a reading")
+	}
+	if _, err := p.WatchAlarm(ctx, time.Millisecond); !errors.Is(err, pzem.ErrClosed) {
+		t.Errorf("WatchAlarm() on a closed probe = %v, want ErrClosed", err)
+	}
+	if _, err := p.StartWatchdog(ctx, time.Millisecond, 1); !errors.Is(err, pzem.ErrClosed) {
+		t.Errorf("StartWatchdog() on a closed probe = %v, want ErrClosed", err)
+	}
+}
@@ -0,0 +1,68 @@
+package pzem
+
+import (
+	"context"
+	"fmt"
+)
+
+// ReadAllContext is like ReadAll but returns ctx.Err() as soon as ctx is done.
+// An abandoned transaction still runs to its end (at most Config.TimeOut) in
+// the background, holding the probe until then, and its result is dropped.
+func (p *pzem) ReadAllContext(ctx context.Context) (Measurement, error) {
+	if err := ctx.Err(); err != nil {
+		return Measurement{}, err
+	}
+
+	type result struct {
+		m   Measurement
+		err error
+	}
+	done := make(chan result, 1) // Buffered so an abandoned read does not leak
+	go func() {
+		m, err := p.ReadAll()
+		done <- result{m, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return Measurement{}, ctx.Err()
+	case r := <-done:
+		return r.m, r.err
+	}
+}
+
+func (p *pzem) VoltageContext(ctx context.Context) (float32, error) {
+	m, err := p.ReadAllContext(ctx)
+	return m.Voltage, err
+}
+
+func (p *pzem) IntensityContext(ctx context.Context) (float32, error) {
+	m, err := p.ReadAllContext(ctx)
+	return m.Current, err
+}
+
+func (p *pzem) PowerContext(ctx context.Context) (float32, error) {
+	m, err := p.ReadAllContext(ctx)
+	return m.Power, err
+}
+
+func (p *pzem) EnergyContext(ctx context.Context) (float32, error) {
+	m, err := p.ReadAllContext(ctx)
+	return m.Energy, err
+}
+
+func (p *pzem) FrequencyContext(ctx context.Context) (float32, error) {
+	if p.model == DC017 {
+		return 0.0, fmt.Errorf("frequency: %w", ErrUnsupported)
+	}
+	m, err := p.ReadAllContext(ctx)
+	return m.Frequency, err
+}
+
+func (p *pzem) PowerFactorContext(ctx context.Context) (float32, error) {
+	if p.model == DC017 {
+		return 0.0, fmt.Errorf("power factor: %w", ErrUnsupported)
+	}
+	m, err := p.ReadAllContext(ctx)
+	return m.PowerFactor, err
+}
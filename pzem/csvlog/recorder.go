@@ -0,0 +1,95 @@
+// Package csvlog records PZEM measurements as CSV
+package csvlog
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/be-ys/pzem-004t-v3/pzem"
+)
+
+// Header is the first row written by a Recorder, with the unit of each column
+var Header = []string{
+	"time",
+	"voltage_v",
+	"current_a",
+	"power_w",
+	"energy_wh",
+	"frequency_hz",
+	"power_factor",
+	"alarm",
+}
+
+// Recorder writes measurements as CSV rows. It is safe for concurrent use.
+type Recorder struct {
+	mu        sync.Mutex
+	w         *csv.Writer
+	flush     time.Duration
+	lastFlush time.Time
+	started   bool // Header written
+}
+
+// NewRecorder creates a recorder writing to w. Rows are buffered and flushed
+// once flushEvery elapsed since the previous flush, 0 flushes every row.
+func NewRecorder(w io.Writer, flushEvery time.Duration) *Recorder {
+	return &Recorder{w: csv.NewWriter(w), flush: flushEvery, lastFlush: time.Now()}
+}
+
+// Record appends a row for m, timestamped with the time m was read (or now,
+// when m has no time). It returns the first write error of the underlying
+// writer, the row may then be lost.
+func (r *Recorder) Record(m pzem.Measurement) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.started {
+		if err := r.w.Write(Header); err != nil {
+			return err
+		}
+		r.started = true
+	}
+
+	t := m.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+
+	f := func(v float32) string {
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	}
+	row := []string{
+		t.Format(time.RFC3339Nano),
+		f(m.Voltage),
+		f(m.Current),
+		f(m.Power),
+		f(m.Energy),
+		f(m.Frequency),
+		f(m.PowerFactor),
+		strconv.FormatBool(m.Alarm),
+	}
+	if err := r.w.Write(row); err != nil {
+		return err
+	}
+
+	if time.Since(r.lastFlush) >= r.flush {
+		return r.flushLocked()
+	}
+	return nil
+}
+
+// Flush writes the buffered rows to the underlying writer
+func (r *Recorder) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.flushLocked()
+}
+
+func (r *Recorder) flushLocked() error {
+	r.w.Flush()
+	r.lastFlush = time.Now()
+	return r.w.Error()
+}
@@ -0,0 +1,167 @@
+package csvlog_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/be-ys/pzem-004t-v3/pzem"
+	"github.com/be-ys/pzem-004t-v3/pzem/csvlog"
+	"github.com/be-ys/pzem-004t-v3/pzem/pzemtest"
+)
+
+func rows(t *testing.T, b *bytes.Buffer) [][]string {
+	t.Helper()
+
+	records, err := csv.NewReader(bytes.NewReader(b.Bytes())).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func TestRecordFromDevice(t *testing.T) {
+	d := pzemtest.NewFakeDevice(pzem.Measurement{Voltage: 230.1, Current: 1.5, Power: 345, Energy: 1200, Frequency: 50, PowerFactor: 0.98})
+	p, err := pzem.SetupWithTransport(d, pzem.Config{SlaveArddress: 1, UpdateInterval: time.Nanosecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	r := csvlog.NewRecorder(&b, 0)
+	for i := 0; i < 4; i++ {
+		if i == 1 {
+			d.InjectException(0x04)
+		}
+		m, err := p.ReadAll()
+		if err != nil { // A failed read leaves no row
+			if i != 1 {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := r.Record(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := rows(t, &b)
+	if len(got) != 4 {
+		t.Fatalf("got %d rows, want the header and 3 rows", len(got))
+	}
+	if !reflect.DeepEqual(got[0], csvlog.Header) {
+		t.Errorf("header = %q, want %q", got[0], csvlog.Header)
+	}
+	for _, row := range got[1:] {
+		if _, err := time.Parse(time.RFC3339Nano, row[0]); err != nil {
+			t.Errorf("time column: %v", err)
+		}
+		if want := []string{"230.1", "1.5", "345", "1200", "50", "0.98", "false"}; !reflect.DeepEqual(row[1:], want) {
+			t.Errorf("row = %q, want %q", row[1:], want)
+		}
+	}
+}
+
+func TestRecordColumns(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 600000000, time.UTC)
+	tests := []struct {
+		name string
+		m    pzem.Measurement
+		want []string
+	}{
+		{
+			"AC",
+			pzem.Measurement{Voltage: 229.9, Current: 0.25, Power: 57.5, Energy: 42, Frequency: 49.9, PowerFactor: 1, Alarm: true, Time: at},
+			[]string{"2024-01-02T03:04:05.6Z", "229.9", "0.25", "57.5", "42", "49.9", "1", "true"},
+		},
+		{
+			// Same columns, DC meters have no frequency nor power factor
+			"DC",
+			pzem.Measurement{Voltage: 48.52, Current: 10.01, Power: 485.7, Energy: 3, Alarm: true, HighVoltageAlarm: true, Time: at},
+			[]string{"2024-01-02T03:04:05.6Z", "48.52", "10.01", "485.7", "3", "0", "0", "true"},
+		},
+	}
+
+	for _, tt := range tests {
+		var b bytes.Buffer
+		if err := csvlog.NewRecorder(&b, 0).Record(tt.m); err != nil {
+			t.Fatal(err)
+		}
+		got := rows(t, &b)
+		if len(got) != 2 || !reflect.DeepEqual(got[1], tt.want) {
+			t.Errorf("%s: rows = %q, want %q after the header", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRecordNoTime(t *testing.T) {
+	var b bytes.Buffer
+	before := time.Now()
+	if err := csvlog.NewRecorder(&b, 0).Record(pzem.Measurement{}); err != nil {
+		t.Fatal(err)
+	}
+
+	at, err := time.Parse(time.RFC3339Nano, rows(t, &b)[1][0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if at.Before(before.Truncate(time.Second)) || at.After(time.Now()) {
+		t.Errorf("row timestamped %v, want now", at)
+	}
+}
+
+func TestFlushEvery(t *testing.T) {
+	var b bytes.Buffer
+	r := csvlog.NewRecorder(&b, time.Hour)
+	for i := 0; i < 2; i++ {
+		if err := r.Record(pzem.Measurement{Voltage: 230}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if b.Len() != 0 {
+		t.Fatalf("wrote %q before the flush interval", b.String())
+	}
+
+	if err := r.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := rows(t, &b); len(got) != 3 {
+		t.Fatalf("got %d rows after Flush, want the header and 2 rows", len(got))
+	}
+
+	// The header is not written again after a flush
+	if err := r.Record(pzem.Measurement{Voltage: 231}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	got := rows(t, &b)
+	if len(got) != 4 || got[3][1] != "231" {
+		t.Errorf("rows = %q, want the header once and 3 rows", got)
+	}
+}
+
+var errDisk = errors.New("disk full")
+
+type failingWriter struct{}
+
+func (failingWriter) Write(b []byte) (int, error) { return 0, errDisk }
+
+func TestRecordWriteError(t *testing.T) {
+	r := csvlog.NewRecorder(failingWriter{}, 0)
+	if err := r.Record(pzem.Measurement{Voltage: 230}); !errors.Is(err, errDisk) {
+		t.Errorf("Record() = %v, want the error of the writer", err)
+	}
+
+	r = csvlog.NewRecorder(failingWriter{}, time.Hour)
+	if err := r.Record(pzem.Measurement{Voltage: 230}); err != nil {
+		t.Errorf("Record() before the flush = %v, want nil", err)
+	}
+	if err := r.Flush(); !errors.Is(err, errDisk) {
+		t.Errorf("Flush() = %v, want the error of the writer", err)
+	}
+}
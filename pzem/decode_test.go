@@ -0,0 +1,89 @@
+package pzem_test
+
+import (
+	"testing"
+
+	"github.com/be-ys/pzem-004t-v3/pzem"
+)
+
+func TestParseInputRegisters(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame []byte
+		want  pzem.Measurement
+	}{
+		{
+			name: "AC with high words",
+			frame: withCRC(0x01, 0x04, 0x14,
+				0x08, 0xFD, // Voltage 2301
+				0x23, 0x45, 0x00, 0x01, // Current 0x00012345, low word first
+				0x87, 0x65, 0x00, 0x02, // Power 0x00028765
+				0x12, 0x34, 0x00, 0x00, // Energy 0x00001234
+				0x01, 0xF4, // Frequency 500
+				0x00, 0x62, // Power factor 98
+				0xFF, 0xFF, // Alarm
+			),
+			want: pzem.Measurement{
+				Voltage:     230.1,
+				Current:     74.565,
+				Power:       16573.3,
+				Energy:      4660,
+				Frequency:   50,
+				PowerFactor: 0.98,
+				Alarm:       true,
+			},
+		},
+		{
+			name: "AC idle",
+			frame: withCRC(0x01, 0x04, 0x14,
+				0x09, 0x02, // Voltage 2306
+				0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x00,
+				0xE8, 0x03, 0x00, 0x00, // Energy 0xE803
+				0x01, 0xF3, // Frequency 499
+				0x00, 0x00,
+				0x00, 0x00,
+			),
+			want: pzem.Measurement{
+				Voltage:   230.6,
+				Energy:    59395,
+				Frequency: 49.9,
+			},
+		},
+		{
+			name: "DC with high words",
+			frame: withCRC(0x01, 0x04, 0x10,
+				0x04, 0xE2, // Voltage 1250
+				0x02, 0x0B, // Current 523
+				0x56, 0x78, 0x00, 0x07, // Power 0x00075678
+				0x43, 0x21, 0x00, 0x01, // Energy 0x00014321
+				0xFF, 0xFF, // High voltage alarm
+				0x00, 0x00, // Low voltage alarm
+			),
+			want: pzem.Measurement{
+				Voltage:          12.5,
+				Current:          5.23,
+				Power:            48088.8,
+				Energy:           82721,
+				Alarm:            true,
+				HighVoltageAlarm: true,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := pzem.ParseInputRegisters(tt.frame)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Voltage != tt.want.Voltage || m.Current != tt.want.Current ||
+				m.Power != tt.want.Power || m.Energy != tt.want.Energy ||
+				m.Frequency != tt.want.Frequency || m.PowerFactor != tt.want.PowerFactor ||
+				m.Alarm != tt.want.Alarm || m.HighVoltageAlarm != tt.want.HighVoltageAlarm ||
+				m.LowVoltageAlarm != tt.want.LowVoltageAlarm {
+				t.Errorf("got %+v, want %+v", m, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package pzem
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// Discover scans the addresses 0x01-0xF7 of the bus behind the transport and
+// returns the ones a device answered at. config.TimeOut bounds the wait at
+// each address and should be set: a full scan can take 247 times as long.
+// The transport is left open.
+func Discover(ctx context.Context, transport io.ReadWriteCloser, config Config) ([]uint8, error) {
+	return DiscoverProgress(ctx, transport, config, nil)
+}
+
+// DiscoverProgress is Discover with a callback invoked after each address
+// has been tried
+func DiscoverProgress(ctx context.Context, transport io.ReadWriteCloser, config Config, progress func(addr uint8, found bool)) ([]uint8, error) {
+	if transport == nil {
+		return nil, errors.New("transport must be set")
+	}
+	config.SlaveArddress = PzemDefaultAddress // Nothing gets written at setup
+	if err := config.check(); err != nil {
+		return nil, err
+	}
+	p, err := newProbe(sharedPort{transport}, config, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []uint8
+	for addr := uint8(0x01); addr <= 0xF7; addr++ {
+		if err := ctx.Err(); err != nil {
+			return found, err
+		}
+
+		ok := p.discover(addr)
+		if ok {
+			found = append(found, addr)
+		}
+		if progress != nil {
+			progress(addr, ok)
+		}
+	}
+	return found, nil
+}
+
+// discover reports whether a device answers at addr
+func (p *pzem) discover(addr uint8) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	defer p.acquire()()
+
+	return p.answers(addr)
+}
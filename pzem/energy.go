@@ -0,0 +1,55 @@
+package pzem
+
+import "sync"
+
+// EnergyDelta tracks the energy consumed since a baseline, across counter
+// resets. It is safe for concurrent use.
+type EnergyDelta struct {
+	mu       sync.Mutex
+	probe    Probe
+	base     float32 // Counter value at the baseline, or 0 after a reset
+	last     float32 // Counter value at the previous read
+	consumed float32 // Consumed before the last reset
+	resets   int
+}
+
+// NewEnergyDelta reads the energy counter of p and takes it as baseline
+func NewEnergyDelta(p Probe) (*EnergyDelta, error) {
+	energy, err := p.Energy()
+	if err != nil {
+		return nil, err
+	}
+	return &EnergyDelta{probe: p, base: energy, last: energy}, nil
+}
+
+// ConsumedSince returns the energy consumed since the baseline, in Wh. When
+// the counter went down, it has been reset: what was consumed up to the
+// previous read is kept and counting goes on from 0. Energy consumed between
+// that read and the reset is lost, so read often enough.
+func (d *EnergyDelta) ConsumedSince() (float32, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Read under the lock, an older value processed last would look like a reset
+	energy, err := d.probe.Energy()
+	if err != nil {
+		return 0.0, err
+	}
+
+	if energy < d.last {
+		d.consumed += d.last - d.base
+		d.base = 0
+		d.resets++
+	}
+	d.last = energy
+
+	return d.consumed + energy - d.base, nil
+}
+
+// Resets returns the number of counter resets ConsumedSince detected
+func (d *EnergyDelta) Resets() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.resets
+}
@@ -0,0 +1,66 @@
+package pzem
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrWritesDisabled is returned by write operations on a read-only probe
+	ErrWritesDisabled = errors.New("writes are disabled on this probe")
+	// ErrClosed is returned when using a probe after Close()
+	ErrClosed = errors.New("probe is closed")
+	// ErrNotConnected is returned by a transaction on a probe without a port
+	ErrNotConnected = errors.New("probe has no port")
+	// ErrCRC is returned when a reply fails its CRC check
+	ErrCRC = errors.New("recieved CRC is not valid")
+	// ErrShortRead is returned when a reply is shorter than expected
+	ErrShortRead = errors.New("short read")
+	// ErrTimeout is returned when the device did not reply at all, e.g. it is
+	// absent or the line is silent
+	ErrTimeout = errors.New("no reply before the timeout")
+	// ErrMalformedFrame is returned when a reply passing its CRC check does
+	// not match the request (address, command or byte count)
+	ErrMalformedFrame = errors.New("malformed frame")
+	// ErrStale is matched by the error of a read failing with
+	// ReturnCachedOnError, when the previous values are returned
+	ErrStale = errors.New("values are stale")
+	// ErrImplausible is returned when a value read is out of the configured
+	// bounds
+	ErrImplausible = errors.New("implausible value")
+	// ErrUnsupported is returned for a feature the device model does not have
+	ErrUnsupported = errors.New("not supported by this device model")
+
+	// ErrIllegalCommand is the device exception for an unsupported command
+	ErrIllegalCommand = errors.New("Illegal command")
+	// ErrIllegalAddress is the device exception for a wrong register address
+	ErrIllegalAddress = errors.New("Illegal address")
+	// ErrIllegalData is the device exception for a rejected value
+	ErrIllegalData = errors.New("Illegal data")
+	// ErrSlaveError is the device exception for an internal failure
+	ErrSlaveError = errors.New("Slave error")
+	// ErrUnknownException is returned for an exception code not listed above
+	ErrUnknownException = errors.New("Unknown error")
+)
+
+// portError marks an error returned by the transport itself
+type portError struct {
+	op  string // read or write
+	err error
+}
+
+func (e portError) Error() string { return e.op + " failed: " + e.err.Error() }
+func (e portError) Unwrap() error { return e.err }
+
+// staleError is the error of a failed read returning the previous values
+type staleError struct {
+	at  time.Time // When the returned values were read
+	err error
+}
+
+func (e staleError) Error() string {
+	return fmt.Sprintf("%v, returning values read at %s", e.err, e.at.Format(time.RFC3339))
+}
+func (e staleError) Unwrap() error        { return e.err }
+func (e staleError) Is(target error) bool { return target == ErrStale }
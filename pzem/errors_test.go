@@ -0,0 +1,85 @@
+package pzem_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/be-ys/pzem-004t-v3/pzem"
+	"github.com/be-ys/pzem-004t-v3/pzem/pzemtest"
+)
+
+var exceptions = []struct {
+	code uint8
+	want error
+}{
+	{0x01, pzem.ErrIllegalCommand},
+	{0x02, pzem.ErrIllegalAddress},
+	{0x03, pzem.ErrIllegalData},
+	{0x04, pzem.ErrSlaveError},
+	{0x09, pzem.ErrUnknownException},
+}
+
+func TestReadException(t *testing.T) {
+	for _, tt := range exceptions {
+		p, d := setupFake(t, pzem.Measurement{Voltage: 230})
+		d.InjectException(tt.code)
+
+		if _, err := p.ForceRead(); !errors.Is(err, tt.want) {
+			t.Errorf("exception 0x%.2x: got %v, want %v", tt.code, err, tt.want)
+		}
+	}
+}
+
+func TestWriteException(t *testing.T) {
+	for _, tt := range exceptions {
+		p, d := setupFake(t, pzem.Measurement{Voltage: 230})
+		d.InjectException(tt.code)
+
+		if err := p.WriteRegister(pzem.AlarmThrhreshold, 100); !errors.Is(err, tt.want) {
+			t.Errorf("exception 0x%.2x: got %v, want %v", tt.code, err, tt.want)
+		}
+	}
+}
+
+func TestHoldingReadException(t *testing.T) {
+	p, d := setupFake(t, pzem.Measurement{Voltage: 230})
+	d.InjectException(0x02)
+
+	if _, err := p.ReadHoldingRegisters(pzem.AlarmThrhreshold, 1); !errors.Is(err, pzem.ErrIllegalAddress) {
+		t.Errorf("got %v, want ErrIllegalAddress", err)
+	}
+}
+
+func TestResetException(t *testing.T) {
+	p, d := setupFake(t, pzem.Measurement{Voltage: 230})
+	d.InjectException(0x04)
+
+	if err := p.ResetEnergy(); !errors.Is(err, pzem.ErrSlaveError) {
+		t.Errorf("got %v, want ErrSlaveError", err)
+	}
+}
+
+func TestNoReplyTimesOut(t *testing.T) {
+	d := pzemtest.NewFakeDevice(pzem.Measurement{Voltage: 230})
+	// The fake answers its own address and the general one, never this one
+	b, err := pzem.NewBus(d, pzem.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := b.Device(0x09) // Its setup times out too
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := p.Stats().Timeouts
+
+	_, err = p.ReadAll()
+	if !errors.Is(err, pzem.ErrTimeout) {
+		t.Errorf("ReadAll() = %v, want ErrTimeout", err)
+	}
+	if errors.Is(err, pzem.ErrShortRead) {
+		t.Errorf("ReadAll() = %v, should not be a short read", err)
+	}
+	if n := p.Stats().Timeouts - before; n != 1 {
+		t.Errorf("ReadAll() counted %d timeouts, want 1", n)
+	}
+}
@@ -0,0 +1,29 @@
+package pzem
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestIsErrorAnyCommand(t *testing.T) {
+	tests := []struct {
+		reply []uint8
+		want  error
+	}{
+		{[]uint8{0x01, 0x83, 0x02}, ErrIllegalAddress},   // ReadHoldingRegister
+		{[]uint8{0x01, 0x84, 0x01}, ErrIllegalCommand},   // ReadInputRegister
+		{[]uint8{0x01, 0x86, 0x03}, ErrIllegalData},      // WriteSingleRegister
+		{[]uint8{0xF8, 0xC1, 0x04}, ErrSlaveError},       // Calibration
+		{[]uint8{0x01, 0xC2, 0x09}, ErrUnknownException}, // ResetEnergy
+	}
+
+	for _, tt := range tests {
+		if err := isError(tt.reply); !errors.Is(err, tt.want) {
+			t.Errorf("isError(% x) = %v, want %v", tt.reply, err, tt.want)
+		}
+	}
+
+	if err := isError([]uint8{0x01, 0x06, 0x00}); err != nil {
+		t.Errorf("isError of a normal reply = %v", err)
+	}
+}
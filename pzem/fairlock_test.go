@@ -0,0 +1,32 @@
+package pzem
+
+import "testing"
+
+func TestFairLockOrder(t *testing.T) {
+	var l fairLock
+	l.Lock()
+
+	const n = 10
+	order := make(chan int, n)
+	for i := 0; i < n; i++ {
+		i := i
+		go func() {
+			l.Lock()
+			order <- i
+			l.Unlock()
+		}()
+
+		for queued := false; !queued; { // Wait for it to queue up before the next one
+			l.mu.Lock()
+			queued = len(l.waiting) == i+1
+			l.mu.Unlock()
+		}
+	}
+
+	l.Unlock()
+	for want := 0; want < n; want++ {
+		if got := <-order; got != want {
+			t.Fatalf("lock granted to waiter %d, want %d", got, want)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package pzem
+
+import "fmt"
+
+// buildFrame builds an 8 bytes request: a register read or a register write
+func buildFrame(addr uint8, cmd Command, reg Register, val uint16) []uint8 {
+	frame := make([]uint8, 8)
+
+	frame[0] = addr       // Set slave address
+	frame[1] = uint8(cmd) // Set command
+
+	frame[2] = uint8(reg>>8) & 0xFF // Set high byte of register address
+	frame[3] = uint8(reg) & 0xFF    // Set low byte =//=
+
+	frame[4] = uint8(val>>8) & 0xFF // Set high byte of register value
+	frame[5] = uint8(val) & 0xFF    // Set low byte =//=
+
+	setCRC(frame)
+	return frame
+}
+
+// BuildReadFrame builds the request reading count registers from reg, CRC
+// included. cmd is ReadInputRegister or ReadHoldingRegister.
+func BuildReadFrame(addr uint8, cmd Command, reg Register, count uint16) []byte {
+	return buildFrame(addr, cmd, reg, count)
+}
+
+// ParseInputRegisters decodes the reply to a read of all the input registers,
+// from a PZEM-004T or a PZEM-017 according to its length. Time is left unset.
+func ParseInputRegisters(frame []byte) (Measurement, error) {
+	if len(frame) < 5 {
+		return Measurement{}, fmt.Errorf("frame of %d bytes: %w", len(frame), ErrShortRead)
+	}
+	if !checkCRC(frame) {
+		return Measurement{}, ErrCRC
+	}
+	if err := isError(frame); err != nil {
+		return Measurement{}, err
+	}
+	if Command(frame[1]) != ReadInputRegister {
+		return Measurement{}, fmt.Errorf("reply to command 0x%.2x: %w", frame[1], ErrMalformedFrame)
+	}
+
+	var model DeviceModel
+	switch frame[2] {
+	case 2 * acRegisters:
+		model = AC004T
+	case 2 * dcRegisters:
+		model = DC017
+	default:
+		return Measurement{}, fmt.Errorf("unexpected byte count %d: %w", frame[2], ErrMalformedFrame)
+	}
+	if len(frame) != 5+int(frame[2]) {
+		return Measurement{}, fmt.Errorf("frame of %d bytes for a byte count of %d: %w", len(frame), frame[2], ErrMalformedFrame)
+	}
+
+	p := &pzem{model: model}
+	p.decode(frame)
+	return p.snapshot(), nil
+}
@@ -0,0 +1,122 @@
+package pzem_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/be-ys/pzem-004t-v3/crc16"
+	"github.com/be-ys/pzem-004t-v3/pzem"
+	"github.com/be-ys/pzem-004t-v3/pzem/pzemtest"
+)
+
+func TestParseInputRegistersMalformed(t *testing.T) {
+	regs := make([]byte, 20)
+	tests := []struct {
+		name  string
+		frame []byte
+	}{
+		{"byte count of no model", withCRC(append([]byte{0x01, 0x04, 0x12}, regs[:18]...)...)},
+		{"byte count longer than the frame", withCRC(append([]byte{0x01, 0x04, 0x14}, regs[:16]...)...)},
+		{"holding register reply", withCRC(append([]byte{0x01, 0x03, 0x14}, regs...)...)},
+	}
+
+	for _, tt := range tests {
+		if _, err := pzem.ParseInputRegisters(tt.frame); !errors.Is(err, pzem.ErrMalformedFrame) {
+			t.Errorf("%s: got %v, want ErrMalformedFrame", tt.name, err)
+		}
+	}
+}
+
+// tampered alters the replies of a fake device, then fixes their CRC
+type tampered struct {
+	*pzemtest.FakeDevice
+	alter func(reply []byte)
+}
+
+func (d *tampered) Read(b []byte) (int, error) {
+	n, err := d.FakeDevice.Read(b)
+	if d.alter != nil && n > 4 {
+		d.alter(b[:n])
+		crc := crc16.CRC(b[:n-2])
+		b[n-2], b[n-1] = uint8(crc), uint8(crc>>8)
+	}
+	return n, err
+}
+
+func TestReadMalformedReply(t *testing.T) {
+	tests := []struct {
+		name  string
+		alter func(reply []byte)
+	}{
+		{"wrong address", func(reply []byte) { reply[0] = 0x02 }},
+		{"wrong command", func(reply []byte) { reply[1] = byte(pzem.ReadHoldingRegister) }},
+		{"wrong byte count", func(reply []byte) { reply[2] -= 2 }},
+	}
+
+	for _, tt := range tests {
+		d := &tampered{FakeDevice: pzemtest.NewFakeDevice(pzem.Measurement{Voltage: 230})}
+		p, err := pzem.SetupWithTransport(d, pzem.Config{SlaveArddress: 1, UpdateInterval: time.Hour})
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.alter = tt.alter
+
+		if _, err := p.ReadAll(); !errors.Is(err, pzem.ErrMalformedFrame) {
+			t.Errorf("%s: ReadAll() = %v, want ErrMalformedFrame", tt.name, err)
+		}
+		if _, err := p.ReadInputRegisters(pzem.Voltage, 2); !errors.Is(err, pzem.ErrMalformedFrame) {
+			t.Errorf("%s: ReadInputRegisters() = %v, want ErrMalformedFrame", tt.name, err)
+		}
+	}
+}
+
+// noisy prefixes the replies of a fake device with line noise and, when
+// truncate is set, drops their last two bytes. Like a serial port on
+// Windows it returns (0, nil) when nothing comes before the read timeout.
+type noisy struct {
+	*pzemtest.FakeDevice
+	truncate bool
+	pending  []byte
+}
+
+func (d *noisy) Read(b []byte) (int, error) {
+	if len(d.pending) == 0 {
+		reply := make([]byte, 64)
+		if n, _ := d.FakeDevice.Read(reply); n > 0 {
+			if d.truncate {
+				n -= 2
+			}
+			d.pending = append([]byte{0x00, 0xFF}, reply[:n]...)
+		}
+	}
+	n := copy(b, d.pending)
+	d.pending = d.pending[n:]
+	return n, nil
+}
+
+func TestResyncGivesUpAtTimeout(t *testing.T) {
+	d := &noisy{FakeDevice: pzemtest.NewFakeDevice(pzem.Measurement{Voltage: 230})}
+	p, err := pzem.SetupWithTransport(d, pzem.Config{SlaveArddress: 1, UpdateInterval: time.Nanosecond, MaxLeadingGarbage: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := p.Voltage(); err != nil || v != 230 {
+		t.Fatalf("Voltage() after line noise = %v, %v, want 230", v, err)
+	}
+
+	d.truncate = true
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.ReadAll()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, pzem.ErrShortRead) {
+			t.Errorf("ReadAll() of a truncated frame = %v, want ErrShortRead", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ReadAll() hangs on a truncated frame after line noise")
+	}
+}
@@ -0,0 +1,77 @@
+// Package httpapi serves a PZEM probe over HTTP as JSON
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/be-ys/pzem-004t-v3/pzem"
+)
+
+// Handler serves p:
+//
+//	GET /reading   the latest Measurement
+//	POST /reset    resets the energy counter
+//
+// Failing to reach the device answers 503, a write on a read-only probe 403
+// and an invalid request 400, with the error as {"error": "..."}.
+func Handler(p pzem.Probe) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/reading", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+
+		m, err := p.ReadAll()
+		if err != nil {
+			writeError(w, status(err), err)
+			return
+		}
+		writeJSON(w, http.StatusOK, m)
+	})
+
+	mux.HandleFunc("/reset", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+
+		if len(r.URL.Query()) > 0 {
+			writeError(w, http.StatusBadRequest, errors.New("reset takes no parameter"))
+			return
+		}
+
+		if err := p.ResetEnergy(); err != nil {
+			writeError(w, status(err), err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	return mux
+}
+
+// status returns the HTTP status of a probe error
+func status(err error) int {
+	if errors.Is(err, pzem.ErrWritesDisabled) {
+		return http.StatusForbidden
+	}
+	return http.StatusServiceUnavailable
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
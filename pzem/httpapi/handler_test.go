@@ -0,0 +1,41 @@
+package httpapi_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/be-ys/pzem-004t-v3/pzem"
+	"github.com/be-ys/pzem-004t-v3/pzem/httpapi"
+	"github.com/be-ys/pzem-004t-v3/pzem/pzemtest"
+)
+
+func TestReset(t *testing.T) {
+	d := pzemtest.NewFakeDevice(pzem.Measurement{Voltage: 230, Energy: 1500})
+	p, err := pzem.SetupWithTransport(d, pzem.Config{SlaveArddress: 1, UpdateInterval: time.Nanosecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := httpapi.Handler(p)
+
+	tests := []struct {
+		method, target string
+		want           int
+	}{
+		{http.MethodGet, "/reset", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/reset?all=true", http.StatusBadRequest},
+		{http.MethodPost, "/reset", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, nil))
+		if rec.Code != tt.want {
+			t.Errorf("%s %s: status %d, want %d", tt.method, tt.target, rec.Code, tt.want)
+		}
+	}
+
+	if e := d.Measurement().Energy; e != 0 {
+		t.Errorf("energy is %v after the reset, want 0", e)
+	}
+}
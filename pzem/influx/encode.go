@@ -0,0 +1,66 @@
+// Package influx encodes PZEM measurements in the InfluxDB line protocol
+package influx
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/be-ys/pzem-004t-v3/pzem"
+)
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	tagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+)
+
+// Encode returns the line of m, with its voltage, current, power, energy,
+// frequency and power_factor fields, and t as timestamp in nanoseconds. Tags
+// are sorted by key, as InfluxDB recommends, and tags with an empty key or
+// value are left out since the protocol does not allow them.
+func Encode(measurement string, tags map[string]string, m pzem.Measurement, t time.Time) string {
+	var b strings.Builder
+	b.WriteString(measurementEscaper.Replace(measurement))
+
+	keys := make([]string, 0, len(tags))
+	for k, v := range tags {
+		if k != "" && v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b.WriteByte(',')
+		b.WriteString(tagEscaper.Replace(k))
+		b.WriteByte('=')
+		b.WriteString(tagEscaper.Replace(tags[k]))
+	}
+
+	fields := []struct {
+		key   string
+		value float32
+	}{
+		{"voltage", m.Voltage},
+		{"current", m.Current},
+		{"power", m.Power},
+		{"energy", m.Energy},
+		{"frequency", m.Frequency},
+		{"power_factor", m.PowerFactor},
+	}
+	for i, f := range fields {
+		if i == 0 {
+			b.WriteByte(' ')
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(f.key)
+		b.WriteByte('=')
+		b.WriteString(strconv.FormatFloat(float64(f.value), 'f', -1, 32))
+	}
+
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatInt(t.UnixNano(), 10))
+
+	return b.String()
+}
@@ -0,0 +1,72 @@
+package influx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/be-ys/pzem-004t-v3/pzem"
+)
+
+func TestEncode(t *testing.T) {
+	at := time.Unix(1700000000, 123456789)
+	m := pzem.Measurement{Voltage: 230, Current: 0.1, Power: 23, Energy: 1234, Frequency: 50, PowerFactor: 0.99}
+	fields := " voltage=230,current=0.1,power=23,energy=1234,frequency=50,power_factor=0.99 1700000000123456789"
+
+	tests := []struct {
+		name        string
+		measurement string
+		tags        map[string]string
+		want        string
+	}{
+		{"plain", "power", nil, "power" + fields},
+		{"measurement with spaces and commas", "mains power,L1", nil, `mains\ power\,L1` + fields},
+		{"equal sign in measurement", "a=b", nil, "a=b" + fields},
+		{"tags sorted", "power", map[string]string{"room": "garage", "phase": "L1"}, "power,phase=L1,room=garage" + fields},
+		{"tag escaping", "power", map[string]string{"room name": "a=b,c d"}, `power,room\ name=a\=b\,c\ d` + fields},
+		{"quotes kept", "power", map[string]string{"meter": `"main"`}, `power,meter="main"` + fields},
+		{"backslashes kept", `pow\er`, map[string]string{"path": `C:\meters`}, `pow\er,path=C:\meters` + fields},
+		{"empty tags left out", "power", map[string]string{"": "x", "room": ""}, "power" + fields},
+	}
+
+	for _, tt := range tests {
+		if got := Encode(tt.measurement, tt.tags, m, at); got != tt.want {
+			t.Errorf("%s:\n got %s\nwant %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEncodeFields(t *testing.T) {
+	tests := []struct {
+		name string
+		m    pzem.Measurement
+		want string
+	}{
+		// Whole values stay floats: no i suffix, the field type never changes
+		{"whole values", pzem.Measurement{Voltage: 230, Energy: 100000}, "p voltage=230,current=0,power=0,energy=100000,frequency=0,power_factor=0 0"},
+		{"float32 rounding", pzem.Measurement{Voltage: 229.9, Current: 0.001, PowerFactor: 0.5}, "p voltage=229.9,current=0.001,power=0,energy=0,frequency=0,power_factor=0.5 0"},
+	}
+
+	for _, tt := range tests {
+		if got := Encode("p", nil, tt.m, time.Unix(0, 0)); got != tt.want {
+			t.Errorf("%s:\n got %s\nwant %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEncodeTimestamp(t *testing.T) {
+	tests := []struct {
+		t    time.Time
+		want string
+	}{
+		{time.Unix(0, 0), "0"},
+		{time.Unix(1, 1), "1000000001"},
+		{time.Date(2023, 11, 14, 22, 13, 20, 0, time.FixedZone("CET", 3600)), "1699996400000000000"},
+	}
+
+	for _, tt := range tests {
+		line := Encode("p", nil, pzem.Measurement{}, tt.t)
+		if got := line[len(line)-len(tt.want)-1:]; got != " "+tt.want {
+			t.Errorf("timestamp of %v: got %q, want %q", tt.t, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package pzem
+
+import "sync"
+
+// Process-wide transaction slots, nil when unlimited
+var slots struct {
+	sync.Mutex
+	ch chan struct{}
+}
+
+// SetMaxConcurrentTransactions caps the number of serial transactions running
+// at the same time across every probe of the process, whatever their port.
+// n <= 0 removes the limit. Transactions already running are not affected.
+func SetMaxConcurrentTransactions(n int) {
+	slots.Lock()
+	defer slots.Unlock()
+
+	if n <= 0 {
+		slots.ch = nil
+		return
+	}
+	slots.ch = make(chan struct{}, n)
+}
+
+// acquireSlot blocks until a transaction slot is available and returns the
+// function releasing it
+func acquireSlot() func() {
+	slots.Lock()
+	ch := slots.ch
+	slots.Unlock()
+
+	if ch == nil {
+		return func() {}
+	}
+	ch <- struct{}{}
+	return func() { <-ch }
+}
@@ -0,0 +1,41 @@
+package pzem
+
+// Logger receives the debug output, see Config.Debug. Adapters over logrus,
+// zap or slog only need to forward Debugf.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+}
+
+// nopLogger is the default Logger, discarding everything
+type nopLogger struct{}
+
+func (nopLogger) Debugf(format string, args ...interface{}) {}
+
+// Direction of a frame on the line, see Config.OnFrame
+type Direction int
+
+const (
+	// TX is a frame sent to the device
+	TX Direction = iota
+	// RX is a frame received from the device
+	RX
+)
+
+func (d Direction) String() string {
+	if d == TX {
+		return "TX"
+	}
+	return "RX"
+}
+
+// logFrame passes a frame to the OnFrame hook, and logs it in hex when
+// debugging
+func (p *pzem) logFrame(dir Direction, buf []uint8) {
+	if p.onFrame != nil {
+		p.onFrame(dir, append([]byte(nil), buf...))
+	}
+	if !p.debug {
+		return
+	}
+	p.logger.Debugf("pzem 0x%.2x %s % x", p.addr, dir, buf)
+}
@@ -0,0 +1,155 @@
+package pzem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Measurement is a snapshot of every value read from the device at once,
+// scaled from the registers ReadRaw returns
+type Measurement struct {
+	Voltage     float32 `json:"voltage"`
+	Current     float32 `json:"current"`
+	Power       float32 `json:"power"`
+	Energy      float32 `json:"energy"` // Wh
+	Frequency   float32 `json:"frequency"`
+	PowerFactor float32 `json:"power_factor"`
+	// Alarm is true when the power is over the alarm threshold, or on DC
+	// meters when a voltage alarm is raised
+	Alarm bool `json:"alarm"`
+	// HighVoltageAlarm is the over-voltage alarm of DC meters
+	HighVoltageAlarm bool `json:"high_voltage_alarm"`
+	// LowVoltageAlarm is the under-voltage alarm of DC meters
+	LowVoltageAlarm bool `json:"low_voltage_alarm"`
+	// Time is when the values were read from the device
+	Time time.Time `json:"time"`
+
+	model DeviceModel // Selects the resolution of String()
+}
+
+// String renders the values with their unit, at the resolution of the device
+func (m Measurement) String() string {
+	if m.model == DC017 {
+		return fmt.Sprintf("%.2fV %.2fA %.1fW %.0fWh alarm=%t",
+			m.Voltage, m.Current, m.Power, m.Energy, m.Alarm)
+	}
+	return fmt.Sprintf("%.1fV %.3fA %.1fW %.1fHz %.0fWh pf=%.2f alarm=%t",
+		m.Voltage, m.Current, m.Power, m.Frequency, m.Energy, m.PowerFactor, m.Alarm)
+}
+
+// MarshalJSON encodes the measurement with the shortest decimal form of each
+// value, so that 230.1 is not written as 230.10000610351562
+func (m Measurement) MarshalJSON() ([]byte, error) {
+	f := func(v float32) json.Number {
+		return json.Number(strconv.FormatFloat(float64(v), 'f', -1, 32))
+	}
+
+	return json.Marshal(struct {
+		Voltage          json.Number `json:"voltage"`
+		Current          json.Number `json:"current"`
+		Power            json.Number `json:"power"`
+		Energy           json.Number `json:"energy"`
+		Frequency        json.Number `json:"frequency"`
+		PowerFactor      json.Number `json:"power_factor"`
+		Alarm            bool        `json:"alarm"`
+		HighVoltageAlarm bool        `json:"high_voltage_alarm"`
+		LowVoltageAlarm  bool        `json:"low_voltage_alarm"`
+		Time             time.Time   `json:"time"`
+	}{
+		Voltage:          f(m.Voltage),
+		Current:          f(m.Current),
+		Power:            f(m.Power),
+		Energy:           f(m.Energy),
+		Frequency:        f(m.Frequency),
+		PowerFactor:      f(m.PowerFactor),
+		Alarm:            m.Alarm,
+		HighVoltageAlarm: m.HighVoltageAlarm,
+		LowVoltageAlarm:  m.LowVoltageAlarm,
+		Time:             m.Time,
+	})
+}
+
+// snapshot returns the cached values
+func (p *pzem) snapshot() Measurement {
+	m := Measurement{
+		Voltage:     p.voltage,
+		Current:     p.current,
+		Power:       p.power,
+		Energy:      p.energy,
+		Frequency:   p.frequeny,
+		PowerFactor: p.powerFactor,
+		Alarm:       p.alarms == 0xFFFF,
+		Time:        p.valuesAt,
+		model:       p.model,
+	}
+	if p.model == DC017 {
+		m.HighVoltageAlarm = p.alarms == 0xFFFF
+		m.LowVoltageAlarm = p.lowAlarm == 0xFFFF
+		m.Alarm = m.HighVoltageAlarm || m.LowVoltageAlarm
+	}
+	return m
+}
+
+// ReadAll returns all the values from a single read, so they all belong to
+// the same sample. With ReturnCachedOnError, a failed read returns the
+// previous values along with an error matching ErrStale.
+func (p *pzem) ReadAll() (Measurement, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.updateValues(); err != nil {
+		if p.returnStale && !p.valuesAt.IsZero() && !errors.Is(err, ErrClosed) {
+			return p.snapshot(), staleError{p.valuesAt, err}
+		}
+		return Measurement{}, err
+	}
+	return p.snapshot(), nil
+}
+
+// RawMeasurement holds the input registers as read from the device, indexed
+// by Register (Registers[Voltage], Registers[PowerLow]...). DC meters only
+// have 8 registers: voltage, current, power low and high words, energy low
+// and high words, high and low voltage alarms.
+type RawMeasurement struct {
+	Registers [acRegisters]uint16
+	// Time is when the registers were read from the device
+	Time time.Time
+}
+
+// ReadRaw returns the registers the cached values were decoded from, reading
+// them from the device when the cache is stale
+func (p *pzem) ReadRaw() (RawMeasurement, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.updateValues(); err != nil {
+		return RawMeasurement{}, err
+	}
+
+	raw := RawMeasurement{Time: p.valuesAt}
+	for i := 0; i < len(p.registers)/2; i++ {
+		raw.Registers[i] = uint16(p.registers[2*i])<<8 | uint16(p.registers[2*i+1])
+	}
+	return raw, nil
+}
+
+// ForceRead reads all the values from the device, ignoring the cache, and
+// caches them
+func (p *pzem) ForceRead() (Measurement, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return Measurement{}, ErrClosed
+	}
+
+	defer p.acquire()()
+
+	if err := p.retry(p.readValues); err != nil {
+		return Measurement{}, err
+	}
+	return p.snapshot(), nil
+}
@@ -0,0 +1,110 @@
+// Package mqtt publishes PZEM measurements to an MQTT broker
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/be-ys/pzem-004t-v3/pzem"
+)
+
+const (
+	// Online is the availability payload published while running
+	Online = "online"
+	// Offline is the availability payload published when stopping. Set it as
+	// the will of the client, on the AvailabilityTopic, so that the broker
+	// publishes it when the connection is lost.
+	Offline = "offline"
+)
+
+// Client is the part of an MQTT client the publisher needs. A paho client
+// fits with a small adapter waiting on the returned token.
+type Client interface {
+	Publish(topic string, qos byte, retained bool, payload []byte) error
+}
+
+// Publisher reads a probe and publishes the values under a topic prefix:
+// prefix/voltage, prefix/current, prefix/power, prefix/energy,
+// prefix/frequency, prefix/power_factor and prefix/alarm, plus the whole
+// measurement as JSON on prefix/state.
+type Publisher struct {
+	client Client
+	prefix string
+	probe  pzem.Probe
+
+	// QoS of the publications, 0 by default
+	QoS byte
+	// OnError is called with read and publish errors, which do not stop Run
+	OnError func(error)
+}
+
+// NewPublisher creates a publisher of p's values to c, under prefix
+func NewPublisher(c Client, prefix string, p pzem.Probe) *Publisher {
+	return &Publisher{client: c, prefix: prefix, probe: p}
+}
+
+// AvailabilityTopic is the topic of the Online and Offline payloads
+func (pub *Publisher) AvailabilityTopic() string {
+	return pub.prefix + "/availability"
+}
+
+// Run publishes Online, then reads and publishes the values every interval
+// until ctx is done. It then publishes Offline and returns ctx.Err().
+func (pub *Publisher) Run(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		return errors.New("publish interval must be positive")
+	}
+
+	pub.publish(pub.AvailabilityTopic(), true, []byte(Online))
+	defer pub.publish(pub.AvailabilityTopic(), true, []byte(Offline))
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+
+		m, err := pub.probe.ReadAll()
+		if err != nil {
+			pub.error(err)
+			continue
+		}
+		pub.publishMeasurement(m)
+	}
+}
+
+func (pub *Publisher) publishMeasurement(m pzem.Measurement) {
+	state, err := json.Marshal(m)
+	if err != nil {
+		pub.error(err)
+		return
+	}
+	pub.publish(pub.prefix+"/state", false, state)
+
+	// Reuse the JSON encoding of each value
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(state, &fields); err != nil {
+		pub.error(err)
+		return
+	}
+	for _, name := range []string{"voltage", "current", "power", "energy", "frequency", "power_factor", "alarm"} {
+		pub.publish(pub.prefix+"/"+name, false, fields[name])
+	}
+}
+
+func (pub *Publisher) publish(topic string, retained bool, payload []byte) {
+	if err := pub.client.Publish(topic, pub.QoS, retained, payload); err != nil {
+		pub.error(err)
+	}
+}
+
+func (pub *Publisher) error(err error) {
+	if pub.OnError != nil {
+		pub.OnError(err)
+	}
+}
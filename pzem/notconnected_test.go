@@ -0,0 +1,18 @@
+package pzem
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestZeroValueProbe(t *testing.T) {
+	if _, err := (&pzem{}).ReadAll(); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("ReadAll() = %v, want ErrNotConnected", err)
+	}
+	if err := (&pzem{}).ResetEnergy(); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("ResetEnergy() = %v, want ErrNotConnected", err)
+	}
+	if err := (&pzem{}).Ping(); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("Ping() = %v, want ErrNotConnected", err)
+	}
+}
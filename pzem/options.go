@@ -0,0 +1,67 @@
+package pzem
+
+import (
+	"context"
+	"time"
+)
+
+// Option sets a configuration value of NewProbe
+type Option func(*Config)
+
+// WithConfig starts from a whole configuration, Port excepted. Options after
+// it override its values.
+func WithConfig(config Config) Option {
+	return func(c *Config) {
+		port := c.Port
+		*c = config
+		c.Port = port
+	}
+}
+
+// WithBaud sets the speed of the serial line
+func WithBaud(baud int) Option {
+	return func(c *Config) { c.Speed = baud }
+}
+
+// WithTimeout sets the read timeout of the serial port
+func WithTimeout(d time.Duration) Option {
+	return func(c *Config) { c.TimeOut = d }
+}
+
+// WithAddress sets the Modbus address of the device
+func WithAddress(addr uint8) Option {
+	return func(c *Config) { c.SlaveArddress = addr }
+}
+
+// WithUpdateInterval sets the interval during which read values are cached
+func WithUpdateInterval(d time.Duration) Option {
+	return func(c *Config) { c.UpdateInterval = d }
+}
+
+// WithLogger sets the Logger receiving the frames sent and received and the
+// decoded values, and turns Debug on for it to get them
+func WithLogger(l Logger) Option {
+	return func(c *Config) {
+		c.Logger = l
+		c.Debug = true
+	}
+}
+
+// WithReconnect reopens the serial port when it fails, and calls onReconnect
+// (if not nil) after each reopening
+func WithReconnect(onReconnect func(err error)) Option {
+	return func(c *Config) {
+		c.ReconnectOnError = true
+		c.OnReconnect = onReconnect
+	}
+}
+
+// NewProbe initialize a PZEM device on the given serial port. Options not
+// given keep the defaults of Config.
+func NewProbe(port string, opts ...Option) (Probe, error) {
+	config := Config{Port: port}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return SetupContext(context.Background(), config)
+}
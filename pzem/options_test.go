@@ -0,0 +1,41 @@
+package pzem_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/be-ys/pzem-004t-v3/pzem"
+	"github.com/be-ys/pzem-004t-v3/pzem/pzemtest"
+)
+
+type lines []string
+
+func (l *lines) Debugf(format string, args ...interface{}) {
+	*l = append(*l, fmt.Sprintf(format, args...))
+}
+
+func TestWithLoggerGetsFrames(t *testing.T) {
+	var logged lines
+	config := pzem.Config{SlaveArddress: 1, UpdateInterval: time.Nanosecond}
+	pzem.WithLogger(&logged)(&config)
+
+	p, err := pzem.SetupWithTransport(pzemtest.NewFakeDevice(pzem.Measurement{Voltage: 230}), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logged = nil
+	if _, err := p.Voltage(); err != nil {
+		t.Fatal(err)
+	}
+
+	var tx, rx bool
+	for _, l := range logged {
+		tx = tx || strings.Contains(l, " TX ")
+		rx = rx || strings.Contains(l, " RX ")
+	}
+	if !tx || !rx {
+		t.Errorf("logged %q, want the frames sent and received", logged)
+	}
+}
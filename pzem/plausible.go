@@ -0,0 +1,46 @@
+package pzem
+
+import "fmt"
+
+// Bounds are the plausible ranges of the decoded values. Frequency is only
+// checked on AC meters.
+type Bounds struct {
+	MinVoltage   float32
+	MaxVoltage   float32
+	MaxCurrent   float32
+	MinFrequency float32
+	MaxFrequency float32
+}
+
+// DefaultBounds are the measuring ranges documented for each model
+var DefaultBounds = map[DeviceModel]Bounds{
+	AC004T: {MinVoltage: 80, MaxVoltage: 260, MaxCurrent: 100, MinFrequency: 45, MaxFrequency: 65},
+	DC017:  {MinVoltage: 0, MaxVoltage: 300, MaxCurrent: 300},
+}
+
+func (b Bounds) check() error {
+	if b.MinVoltage < 0 || b.MaxVoltage < b.MinVoltage {
+		return fmt.Errorf("invalid voltage bounds %v-%vV", b.MinVoltage, b.MaxVoltage)
+	}
+	if b.MaxCurrent < 0 {
+		return fmt.Errorf("invalid current bound %vA", b.MaxCurrent)
+	}
+	if b.MinFrequency < 0 || b.MaxFrequency < b.MinFrequency {
+		return fmt.Errorf("invalid frequency bounds %v-%vHz", b.MinFrequency, b.MaxFrequency)
+	}
+	return nil
+}
+
+// plausible checks the values decoded into v are within the bounds
+func (p *pzem) plausible(v *pzem) error {
+	b := p.bounds
+	switch {
+	case v.voltage < b.MinVoltage || v.voltage > b.MaxVoltage:
+		return fmt.Errorf("voltage of %vV: %w", v.voltage, ErrImplausible)
+	case v.current > b.MaxCurrent:
+		return fmt.Errorf("current of %vA: %w", v.current, ErrImplausible)
+	case p.model == AC004T && (v.frequeny < b.MinFrequency || v.frequeny > b.MaxFrequency):
+		return fmt.Errorf("frequency of %vHz: %w", v.frequeny, ErrImplausible)
+	}
+	return nil
+}
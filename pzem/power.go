@@ -0,0 +1,38 @@
+package pzem
+
+import (
+	"fmt"
+	"math"
+)
+
+// ApparentPower returns V×I, in VA
+func (p *pzem) ApparentPower() (float32, error) {
+	if p.model == DC017 {
+		return 0.0, fmt.Errorf("apparent power: %w", ErrUnsupported)
+	}
+	m, err := p.ReadAll()
+	if err != nil {
+		return 0.0, err
+	}
+	return m.Voltage * m.Current, nil
+}
+
+// ReactivePower returns √(S²-P²), in var, from the apparent and active power of
+// a single read. The device reports the power factor without its sign, so the
+// reactive power is always positive, inductive and capacitive loads alike.
+func (p *pzem) ReactivePower() (float32, error) {
+	if p.model == DC017 {
+		return 0.0, fmt.Errorf("reactive power: %w", ErrUnsupported)
+	}
+	m, err := p.ReadAll()
+	if err != nil {
+		return 0.0, err
+	}
+
+	s := float64(m.Voltage * m.Current)
+	q := s*s - float64(m.Power)*float64(m.Power)
+	if q <= 0 { // Rounding can make P slightly over S
+		return 0.0, nil
+	}
+	return float32(math.Sqrt(q)), nil
+}
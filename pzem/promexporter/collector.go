@@ -0,0 +1,76 @@
+// Package promexporter exposes PZEM measurements as Prometheus metrics
+package promexporter
+
+import (
+	"github.com/be-ys/pzem-004t-v3/pzem"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector reads a Probe on every scrape. It implements prometheus.Collector.
+type Collector struct {
+	probe pzem.Probe
+
+	voltage     *prometheus.Desc
+	current     *prometheus.Desc
+	power       *prometheus.Desc
+	energy      *prometheus.Desc
+	frequency   *prometheus.Desc
+	powerFactor *prometheus.Desc
+	errors      prometheus.Counter
+}
+
+// NewCollector creates a collector for p. labels are attached to every
+// metric, typically the device name and the circuit it measures.
+func NewCollector(p pzem.Probe, labels prometheus.Labels) *Collector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(name, help, nil, labels)
+	}
+
+	return &Collector{
+		probe:       p,
+		voltage:     desc("pzem_voltage_volts", "Voltage measured by the probe."),
+		current:     desc("pzem_current_amperes", "Current measured by the probe."),
+		power:       desc("pzem_power_watts", "Active power measured by the probe."),
+		energy:      desc("pzem_energy_wh", "Energy accumulated by the probe since its last reset."),
+		frequency:   desc("pzem_frequency_hertz", "Line frequency measured by the probe."),
+		powerFactor: desc("pzem_power_factor", "Power factor measured by the probe."),
+		errors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        "pzem_read_errors_total",
+			Help:        "Number of scrapes that failed to read the probe.",
+			ConstLabels: labels,
+		}),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.voltage
+	ch <- c.current
+	ch <- c.power
+	ch <- c.energy
+	ch <- c.frequency
+	ch <- c.powerFactor
+	c.errors.Describe(ch)
+}
+
+// Collect implements prometheus.Collector. A failed read only increments
+// pzem_read_errors_total, the gauges are left out of that scrape.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	m, err := c.probe.ReadAll()
+	if err != nil {
+		c.errors.Inc()
+		c.errors.Collect(ch)
+		return
+	}
+
+	gauge := func(d *prometheus.Desc, v float32) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, float64(v))
+	}
+	gauge(c.voltage, m.Voltage)
+	gauge(c.current, m.Current)
+	gauge(c.power, m.Power)
+	gauge(c.energy, m.Energy)
+	gauge(c.frequency, m.Frequency)
+	gauge(c.powerFactor, m.PowerFactor)
+	c.errors.Collect(ch)
+}
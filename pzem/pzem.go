@@ -1,18 +1,24 @@
 package pzem
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"sync"
 	"time"
 
 	"github.com/be-ys/pzem-004t-v3/crc16"
-
-	"github.com/go-errors/errors"
 	"github.com/tarm/serial"
 )
 
 type Register uint16
 type Command uint8
 
+// DeviceModel selects the register map of the meter
+type DeviceModel uint8
+
 const (
 	//Voltage value 1LSB correspond to 0.1V
 	Voltage Register = 0x0000
@@ -39,6 +45,8 @@ const (
 	ModbusRTUAddress Register = 0x0002
 	//AlarmThrhreshold  1LSB correspond to 1W
 	AlarmThrhreshold Register = 0x0001
+	//CurrentRange shunt rating of DC meters, see the Shunt constants
+	CurrentRange Register = 0x0003
 
 	//ReadHoldingRegister command
 	ReadHoldingRegister Command = 0x03
@@ -51,55 +59,352 @@ const (
 	//ResetEnergy command
 	ResetEnergy Command = 0x42
 
+	// AC004T is the PZEM-004T v3 AC meter
+	AC004T DeviceModel = 0
+	// DC017 is the PZEM-017 (or PZEM-003) DC meter
+	DC017 DeviceModel = 1
+
 	PzemUpdateTime            = 1000
 	PzemDefaultBaudRate       = 9600
 	PzemDefaultAddress  uint8 = 0xF8
+	// PzemCalibrationTime is the time the device needs to calibrate
+	PzemCalibrationTime = 4 * time.Second
+
+	// Shunt100A is the CurrentRange value for a 100A shunt
+	Shunt100A uint16 = 0x0000
+	// Shunt50A is the CurrentRange value for a 50A shunt
+	Shunt50A uint16 = 0x0001
+	// Shunt200A is the CurrentRange value for a 200A shunt
+	Shunt200A uint16 = 0x0002
+	// Shunt300A is the CurrentRange value for a 300A shunt
+	Shunt300A uint16 = 0x0003
+
+	// minInterFrameDelay is the lowest default InterFrameDelay
+	minInterFrameDelay = 2 * time.Millisecond
+	// replyMargin is added to the transmission time of a reply with
+	// AdaptiveTimeOut, for the device to process the request
+	replyMargin = 50 * time.Millisecond
+
+	// Number of input registers of each model
+	acRegisters = 10
+	dcRegisters = 8
+	// maxReplyLength is the length of a reply to a read of all the registers
+	maxReplyLength = 5 + 2*acRegisters
 )
 
 //Probe is PZEM interface
+//
+// Voltage, Intensity, Power, Energy, Frequency and PowerFactor share a single
+// read of all the input registers, cached for Config.UpdateInterval (see
+// SetUpdateInterval). Calling them in sequence within that window performs
+// exactly one device transaction and returns values from the same sample.
+//
+// A Probe is safe for concurrent use by multiple goroutines: every exchange
+// with the device holds the probe lock from the request write to the end of
+// the reply, so transactions never overlap on the serial line.
 type Probe interface {
 	Voltage() (float32, error)
 	Power() (float32, error)
 	Energy() (float32, error)
+	EnergyKWh() (float32, error)
 	Frequency() (float32, error)
 	Intensity() (float32, error)
 	PowerFactor() (float32, error)
+	ApparentPower() (float32, error)
+	ReactivePower() (float32, error)
+	Alarm() (bool, error)
+	ReadAll() (Measurement, error)
+	ForceRead() (Measurement, error)
+	ReadRaw() (RawMeasurement, error)
+	VoltageContext(ctx context.Context) (float32, error)
+	PowerContext(ctx context.Context) (float32, error)
+	EnergyContext(ctx context.Context) (float32, error)
+	FrequencyContext(ctx context.Context) (float32, error)
+	IntensityContext(ctx context.Context) (float32, error)
+	PowerFactorContext(ctx context.Context) (float32, error)
+	ReadAllContext(ctx context.Context) (Measurement, error)
 	ResetEnergy() error
+	ResetAllEnergy() error
+	Calibrate() error
+	GetAlarmThreshold() (uint16, error)
+	GetSlaveAddress() (uint8, error)
+	GetConfig() (DeviceConfig, error)
+	Ping() error
+	ChangeBaud(speed int) error
+	SetAddress(addr uint8) error
+	SetShunt(value uint16) error
+	WaitForEnergy(ctx context.Context, deltaWh float32) error
+	FrameDuration(bytes int) time.Duration
+	Frozen() bool
+	TransactRaw(request []byte) ([]byte, error)
+	CacheExpiresIn() time.Duration
+	LastRead() time.Time
+	Stats() Stats
+	Age() time.Duration
+	SetUpdateInterval(d time.Duration) error
+	SetReadTimeout(d time.Duration) error
+	WiringCheck() (WiringReport, error)
+	VoltageAnomaly() (AnomalyReport, error)
+	ReadAndResetEnergy() (float32, error)
+	ReadInputRegisters(start Register, count uint16) ([]uint16, error)
+	ReadHoldingRegisters(start Register, count uint16) ([]uint16, error)
+	WriteRegister(reg Register, value uint16) error
+	WatchAlarm(ctx context.Context, interval time.Duration) (<-chan bool, error)
+	Stream(ctx context.Context, interval time.Duration) <-chan Reading
+	StartWatchdog(ctx context.Context, interval time.Duration, threshold int) (<-chan WatchdogState, error)
+	Close() error
 }
 
 // Config PZEM initialization
 type Config struct {
-	Port          string
+	Port string
+	// Speed of the serial line, 9600 (default) on AC meters, 1200, 2400, 4800
+	// or 9600 on DC meters
 	Speed         int
 	SlaveArddress uint8
+	// Parity of the serial line, 'N' (default), 'E' or 'O'
+	Parity byte
+	// DataBits of the serial line, Modbus RTU only works with 8 (default)
+	DataBits int
+	// StopBits of the serial line, 1 or 2, defaults to 1 on AC meters and 2
+	// on DC meters
+	StopBits int
+	// TimeOut of a read on the serial port. Replies are read as soon as they
+	// arrive, so this is the longest wait for a device. Defaults to the time
+	// of the longest reply at Speed plus the device turnaround, rounded up
+	// to 100ms (the granularity of serial ports). It can be changed later
+	// with SetReadTimeout.
+	TimeOut time.Duration
+	// AdaptiveTimeOut waits for a reply as long as it takes to transmit at
+	// the configured speed, plus a margin, and at least TimeOut. TimeOut can
+	// then be kept short for quick pings without cutting long replies.
+	AdaptiveTimeOut bool
+	// UpdateInterval during which read values are cached, defaults to
+	// PzemUpdateTime milliseconds
+	UpdateInterval time.Duration
+	// Retries of a read failing with ErrCRC, ErrShortRead or ErrTimeout
+	Retries int
+	// RetryDelay to wait before retrying a read
+	RetryDelay time.Duration
+	// ReadOnly makes every write operation (address change, energy reset)
+	// fail with ErrWritesDisabled
+	ReadOnly bool
+	// FrozenThreshold is the number of successive reads returning identical
+	// registers after which the device is reported as frozen (0 disables)
+	FrozenThreshold int
+	// MaxLeadingGarbage is the number of spurious bytes that may precede a
+	// reply and get discarded. The reply is resynchronized on the slave
+	// address, so it has no effect with the default (broadcast) address.
+	MaxLeadingGarbage int
+	// Model of the meter, defaults to AC004T
+	Model DeviceModel
+	// NominalVoltage of the supply, defaults to PzemDefaultNominalVoltage
+	NominalVoltage float32
+	// VoltageTolerance relative to the nominal voltage, defaults to
+	// PzemDefaultVoltageTolerance
+	VoltageTolerance float32
+	// InterFrameDelay to wait between a request and the reading of its reply,
+	// defaults to 3.5 characters at the configured speed, and at least 2ms
+	InterFrameDelay time.Duration
+	// Logger receives the debug output, discarded by default
+	Logger Logger
+	// Debug logs every frame sent and received, and the decoded values
+	Debug bool
+	// OnFrame is called with a copy of every frame written to the device,
+	// and of every reply read, even incomplete or corrupt
+	OnFrame func(dir Direction, data []byte)
+	// ReconnectOnError reopens the serial port when it fails, and runs the
+	// failed read once more. It has no effect on probes set up with a
+	// transport.
+	ReconnectOnError bool
+	// OnReconnect is called after the port has been reopened, by
+	// ReconnectOnError or StartWatchdog, with the error that caused it. It is
+	// called from its own goroutine and may use the probe.
+	OnReconnect func(err error)
+	// ReturnCachedOnError makes a failed read return the previous values
+	// along with the error, which then matches ErrStale
+	ReturnCachedOnError bool
+	// AlarmDebounce is the number of successive reads WatchAlarm needs to
+	// report an alarm change, defaults to 1
+	AlarmDebounce int
+	// RejectImplausible makes a read fail with ErrImplausible when a decoded
+	// value is out of Bounds, keeping the previous values
+	RejectImplausible bool
+	// Bounds of the plausible values, defaults to the DefaultBounds of the
+	// model
+	Bounds Bounds
+	// MinTransactionInterval is the least time between the start of two
+	// transactions on the line, whatever method issues them. Devices of a
+	// Bus are spaced from the previous transaction of any device of the bus.
+	MinTransactionInterval time.Duration
 }
 
 type pzem struct {
-	port        *serial.Port
+	mu          sync.Mutex // Held for the whole duration of a transaction
+	port        io.ReadWriteCloser
+	bus         *Bus
+	stats       Stats
+	reopen      func() (io.ReadWriteCloser, error) // Nil unless set up with a port name
+	autoReopen  bool
+	onReconnect func(err error)
+	speed       int
+	frameBits   int // Size of a byte on the wire
+	turnaround  time.Duration
+	interFrame  time.Duration // Configured InterFrameDelay, 0 derives it from the speed
+	interval    time.Duration
+	timeout     time.Duration
+	adaptive    bool // Timeout scales with the reply size
+	retries     int
+	retryDelay  time.Duration
+	model       DeviceModel
 	addr        uint8
+	readOnly    bool
+	frozenLimit int
+	maxGarbage  int
+	nominal     float32
+	tolerance   float32
+	debounce    int
+	minGap      time.Duration // Least time between transactions
+	lastTx      time.Time     // Start of the last transaction, off a Bus
+	logger      Logger
+	debug       bool
+	onFrame     func(dir Direction, data []byte)
+	returnStale bool
+	bounds      *Bounds // Nil unless implausible values are rejected
+	registers   []uint8 // Raw registers of the last read
+	identical   int     // Number of successive reads with identical registers
 	voltage     float32
 	current     float32
 	power       float32
 	energy      float32
 	frequeny    float32
 	powerFactor float32
-	alarms      uint16
-	lastRead    time.Time
-}
-
-func debug(buf []uint8) {
-	for _, v := range buf {
-		fmt.Printf("%.2x", v)
-	}
-	fmt.Println()
+	alarms      uint16    // Power alarm, or high voltage alarm on DC meters
+	lowAlarm    uint16    // Low voltage alarm on DC meters
+	lastRead    time.Time // Reference of the cache, zero when invalidated
+	valuesAt    time.Time // When the values were read
+	closed      bool
+	stop        chan struct{}  // Closed by Close to stop the background goroutines
+	workers     sync.WaitGroup // Background goroutines, see spawn
 }
 
 //Setup initialize new PZEM device
 func Setup(config Config) (Probe, error) {
+	return NewProbe(config.Port, WithConfig(config))
+}
 
+// SetupContext is like Setup but returns ctx.Err() if opening the port and
+// setting up the device did not complete before ctx is done. The abandoned
+// setup goes on in the background, and its port gets closed.
+func SetupContext(ctx context.Context, config Config) (Probe, error) {
 	if config.Port == "" {
 		return nil, errors.New("serial port must be set")
 	}
+	if err := config.check(); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c := &serial.Config{
+		Name:        config.Port,
+		Baud:        config.Speed,
+		ReadTimeout: config.TimeOut,
+		Size:        byte(config.DataBits),
+		Parity:      serial.Parity(config.Parity),
+		StopBits:    serial.StopBits(config.StopBits),
+	}
+
+	type result struct {
+		p   *pzem
+		err error
+	}
+	done := make(chan result, 1) // Buffered so an abandoned setup does not leak
+	go func() {
+		s, err := serial.OpenPort(c)
+		if err != nil {
+			done <- result{nil, err}
+			return
+		}
+
+		p, err := newProbe(s, config, nil)
+		if err != nil {
+			s.Close()
+			done <- result{nil, err}
+			return
+		}
+		p.reopen = func() (io.ReadWriteCloser, error) { // At the current speed and timeout
+			c := *c
+			c.Baud = p.speed
+			c.ReadTimeout = p.timeout
+			return serial.OpenPort(&c)
+		}
+		done <- result{p, nil}
+	}()
+
+	select {
+	case <-ctx.Done():
+		go func() {
+			if r := <-done; r.err == nil {
+				r.p.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	case r := <-done:
+		if r.err != nil {
+			return nil, r.err
+		}
+		return r.p, nil
+	}
+}
+
+// SetupWithTransport initialize a PZEM device reached through the given
+// transport instead of a serial port, e.g. a TCP bridge or a mock. Port is
+// ignored, and the transport is expected to enforce its own read timeout.
+// The probe owns the transport and closes it on Close().
+func SetupWithTransport(rw io.ReadWriteCloser, config Config) (Probe, error) {
+	if rw == nil {
+		return nil, fmt.Errorf("transport must be set: %w", ErrNotConnected)
+	}
+	if err := config.check(); err != nil {
+		return nil, err
+	}
+	p, err := newProbe(rw, config, nil)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// SetupWithPort initialize a PZEM device on a serial port opened by the
+// caller, e.g. shared with other Modbus devices. The caller keeps ownership of
+// the port: Close() on the probe leaves it open. Speed and framing settings of
+// config are only used for timings, the port is used as configured.
+func SetupWithPort(port *serial.Port, config Config) (Probe, error) {
+	if port == nil {
+		return nil, errors.New("serial port must be set")
+	}
+	return SetupWithTransport(sharedPort{port}, config)
+}
+
+// sharedPort is a transport the probe does not own, Close() leaves it open
+type sharedPort struct {
+	io.ReadWriter
+}
+
+func (sharedPort) Close() error { return nil }
+
+// Flush discards pending input when the transport supports it
+func (s sharedPort) Flush() error {
+	if f, ok := s.ReadWriter.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// check validates the configuration and sets the defaults
+func (config *Config) check() error {
 	if config.Speed == 0 {
 		config.Speed = PzemDefaultBaudRate
 	}
@@ -107,59 +412,221 @@ func Setup(config Config) (Probe, error) {
 	if config.SlaveArddress == 0 {
 		config.SlaveArddress = PzemDefaultAddress
 	}
+	if err := checkAddress(config.SlaveArddress); err != nil {
+		return err
+	}
 
-	c := &serial.Config{Name: config.Port, Baud: config.Speed}
-	s, err := serial.OpenPort(c)
-	if err != nil {
-		return nil, err
+	if config.Retries < 0 || config.RetryDelay < 0 {
+		return errors.New("retries and retry delay must not be negative")
+	}
+
+	if config.UpdateInterval < 0 {
+		return errors.New("update interval must not be negative")
+	}
+	if config.UpdateInterval == 0 {
+		config.UpdateInterval = PzemUpdateTime * time.Millisecond
+	}
+
+	if config.NominalVoltage == 0 {
+		config.NominalVoltage = PzemDefaultNominalVoltage
+	}
+	if config.VoltageTolerance == 0 {
+		config.VoltageTolerance = PzemDefaultVoltageTolerance
+	}
+	if config.NominalVoltage < 0 || config.VoltageTolerance < 0 {
+		return errors.New("nominal voltage and tolerance must be positive")
+	}
+
+	if config.InterFrameDelay < 0 {
+		return errors.New("inter-frame delay must not be negative")
+	}
+
+	if config.MinTransactionInterval < 0 {
+		return errors.New("min transaction interval must not be negative")
+	}
+
+	if config.AlarmDebounce < 0 {
+		return errors.New("alarm debounce must not be negative")
+	}
+	if config.AlarmDebounce == 0 {
+		config.AlarmDebounce = 1
+	}
+
+	if config.Logger == nil {
+		config.Logger = nopLogger{}
+	}
+
+	if config.Model != AC004T && config.Model != DC017 {
+		return fmt.Errorf("unknown device model %d", config.Model)
+	}
+
+	if config.Bounds == (Bounds{}) {
+		config.Bounds = DefaultBounds[config.Model]
+	}
+	if err := config.Bounds.check(); err != nil {
+		return err
+	}
+
+	if !supportedSpeed(config.Model, config.Speed) {
+		return fmt.Errorf("unsupported speed %d, the device supports %v", config.Speed, speeds[config.Model])
+	}
+
+	if config.TimeOut < 0 {
+		return errors.New("timeout must not be negative")
+	}
+	if config.TimeOut == 0 {
+		config.TimeOut = defaultTimeOut(config.Speed)
+	}
+
+	if config.Parity == 0 {
+		config.Parity = 'N'
+	}
+	if config.DataBits == 0 {
+		config.DataBits = 8
+	}
+	if config.StopBits == 0 {
+		config.StopBits = 1
+		if config.Model == DC017 {
+			config.StopBits = 2 // DC meters use 8N2
+		}
+	}
+	if config.Parity != 'N' && config.Parity != 'E' && config.Parity != 'O' {
+		return fmt.Errorf("unsupported parity %q, should be 'N', 'E' or 'O'", config.Parity)
+	}
+	if config.DataBits != 8 {
+		return fmt.Errorf("unsupported %d data bits, Modbus RTU needs 8", config.DataBits)
+	}
+	if config.StopBits != 1 && config.StopBits != 2 {
+		return fmt.Errorf("unsupported %d stop bits, should be 1 or 2", config.StopBits)
+	}
+
+	return nil
+}
+
+// newProbe creates the probe, bus is nil unless the transport is shared. The
+// probe is returned even when the device setup fails.
+func newProbe(rw io.ReadWriteCloser, config Config, bus *Bus) (*pzem, error) {
+	frameBits := 1 + config.DataBits + config.StopBits // Start bit, data, stop bits
+	if config.Parity != 'N' {
+		frameBits++
+	}
+
+	p := &pzem{
+		port:        rw,
+		bus:         bus,
+		frameBits:   frameBits,
+		interFrame:  config.InterFrameDelay,
+		interval:    config.UpdateInterval,
+		timeout:     config.TimeOut,
+		adaptive:    config.AdaptiveTimeOut,
+		retries:     config.Retries,
+		retryDelay:  config.RetryDelay,
+		model:       config.Model,
+		readOnly:    config.ReadOnly,
+		frozenLimit: config.FrozenThreshold,
+		maxGarbage:  config.MaxLeadingGarbage,
+		nominal:     config.NominalVoltage,
+		tolerance:   config.VoltageTolerance,
+		debounce:    config.AlarmDebounce,
+		minGap:      config.MinTransactionInterval,
+		autoReopen:  config.ReconnectOnError,
+		onReconnect: config.OnReconnect,
+		logger:      config.Logger,
+		debug:       config.Debug,
+		onFrame:     config.OnFrame,
+		returnStale: config.ReturnCachedOnError,
+	}
+	if config.RejectImplausible {
+		p.bounds = &config.Bounds
+	}
+	p.setSpeed(config.Speed)
+
+	return p, p.initDevice(config.SlaveArddress)
+}
+
+// setSpeed sets the speed of the line and the delays depending on it
+func (p *pzem) setSpeed(speed int) {
+	p.speed = speed
+	p.turnaround = p.interFrame
+	if p.turnaround == 0 {
+		p.turnaround = p.frameDuration(7) / 2 // 3.5 characters
+		if p.turnaround < minInterFrameDelay {
+			p.turnaround = minInterFrameDelay
+		}
 	}
-	p := &pzem{port: s}
-	p.initDevice(config.SlaveArddress)
-	return p, nil
 }
 
 func (p *pzem) setSlaveArddress(addr uint8) error {
-	if addr < 0x01 || addr > 0xF7 { // sanity check
-		return errors.New("address provided is incorrect")
+	if p.readOnly {
+		return ErrWritesDisabled
 	}
 
+	if addr < 0x01 || addr > 0xF7 { // The general address cannot be assigned to a device
+		return fmt.Errorf("address provided is incorrect: 0x%.2x is out of the 0x01-0xF7 range", addr)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	defer p.acquire()()
+
 	// Write the new address to the address register
 	if err := p.sendCmd8(WriteSingleRegister, ModbusRTUAddress, uint16(addr), true); err != nil {
+		if !errors.Is(err, ErrTimeout) && !errors.Is(err, ErrShortRead) && !errors.Is(err, ErrCRC) {
+			return err // Refused by the device, or the port failed
+		}
+		// Some firmwares switch address mid-transaction and the echo gets
+		// lost, find out which address the device now answers to
+		if p.answers(addr) {
+			p.addr = addr
+			p.lastRead = time.Time{}
+			return nil
+		}
+		if addr != p.addr && !p.answers(p.addr) {
+			return fmt.Errorf("device answers neither at 0x%.2x nor at 0x%.2x after address change: %w", p.addr, addr, err)
+		}
 		return err
 	}
 
 	p.addr = addr // If successful, update the current slave address
+	p.lastRead = time.Time{}
 
 	return nil
 }
 
-func (p *pzem) sendCmd8(cmd Command, reg Register, val uint16, check bool) error {
-	var sendBuffer = make([]uint8, 8) // Send buffer
-	var respBuffer = make([]uint8, 8) // Response buffer (only used when check is true)
+// SetAddress changes the Modbus address of the device, in the 0x01-0xF7 range.
+// The probe uses the new address only once the device acknowledged it.
+func (p *pzem) SetAddress(addr uint8) error {
+	return p.setSlaveArddress(addr)
+}
 
-	sendBuffer[0] = p.addr     // Set slave address
-	sendBuffer[1] = uint8(cmd) // Set command
+// answers reports whether a device replies to a read at the given address
+func (p *pzem) answers(addr uint8) bool {
+	prev := p.addr
+	p.addr = addr
+	defer func() { p.addr = prev }()
 
-	sendBuffer[2] = uint8(reg>>8) & 0xFF // Set high byte of register address
-	sendBuffer[3] = uint8(reg) & 0xFF    // Set low byte =//=
+	if err := p.sendCmd8(ReadInputRegister, Voltage, 1, false); err != nil {
+		return false
+	}
+	return p.recieve(make([]uint8, 7)) == nil
+}
 
-	sendBuffer[4] = uint8(val>>8) & 0xFF // Set high byte of register value
-	sendBuffer[5] = uint8(val) & 0xFF    // Set low byte =//=
+func (p *pzem) sendCmd8(cmd Command, reg Register, val uint16, check bool) error {
+	if p.closed {
+		return ErrClosed
+	}
 
-	setCRC(sendBuffer)
+	var sendBuffer = buildFrame(p.addr, cmd, reg, val) // Send buffer
+	var respBuffer = make([]uint8, 8)                  // Response buffer (only used when check is true)
 
-	n, err := p.port.Write([]byte(sendBuffer)) // send frame
-	if n < len(sendBuffer) || err != nil {
-		if err != nil {
-			return err
-		}
-		return errors.Errorf("try to send %d, but %d sent", len(sendBuffer), n)
+	if err := p.write(sendBuffer); err != nil { // send frame
+		return err
 	}
 
-	time.Sleep(200 * time.Millisecond)
+	time.Sleep(p.turnaround)
 
 	if check {
-		if err := p.recieve(respBuffer); n <= 0 || err != nil { // if check enabled, read the response
+		if err := p.recieve(respBuffer); err != nil { // if check enabled, read the response
 			return err
 		}
 
@@ -174,28 +641,110 @@ func (p *pzem) sendCmd8(cmd Command, reg Register, val uint16, check bool) error
 	return nil
 }
 
-func (p *pzem) initDevice(addr uint8) {
-	if addr < 0x01 || addr > 0xF8 { // Sanity check of address
+// readRegister reads a single register with the given read command
+func (p *pzem) readRegister(cmd Command, reg Register) (uint16, error) {
+	regs, err := p.readRegisters(cmd, reg, 1)
+	if err != nil {
+		return 0, err
+	}
+	return regs[0], nil
+}
+
+// Speeds supported by each model
+var speeds = map[DeviceModel][]int{
+	AC004T: {9600},
+	DC017:  {1200, 2400, 4800, 9600},
+}
+
+// defaultTimeOut returns the time for the longest reply at speed, 11 bits
+// per byte, plus replyMargin, rounded up to 100ms
+func defaultTimeOut(speed int) time.Duration {
+	d := time.Duration(maxReplyLength*11)*time.Second/time.Duration(speed) + replyMargin
+	return (d + 99*time.Millisecond).Truncate(100 * time.Millisecond)
+}
+
+func supportedSpeed(model DeviceModel, speed int) bool {
+	for _, s := range speeds[model] {
+		if s == speed {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAddress checks addr is a device address (0x01-0xF7) or the general
+// address PzemDefaultAddress, which any device answers to
+func checkAddress(addr uint8) error {
+	if addr < 0x01 || addr > PzemDefaultAddress {
+		return fmt.Errorf("address 0x%.2x is out of the 0x01-0xF7 range, and is not the general address 0x%.2x", addr, PzemDefaultAddress)
+	}
+	return nil
+}
+
+// initDevice sets the address of the probe and, unless it is the general
+// address, writes it to the device to check it answers. An invalid address
+// falls back to PzemDefaultAddress.
+func (p *pzem) initDevice(addr uint8) error {
+	if err := checkAddress(addr); err != nil { // Sanity check of address
 		p.addr = PzemDefaultAddress
+		return err
 	}
 	p.addr = addr
 
-	if p.addr != PzemDefaultAddress {
-		p.setSlaveArddress(p.addr)
+	if p.addr != PzemDefaultAddress && !p.readOnly {
+		return p.setSlaveArddress(p.addr)
 	}
-
+	return nil
 }
 
 func (p *pzem) updateValues() error {
-	response := make([]uint8, 25)
+	if p.closed {
+		return ErrClosed
+	}
 
 	//If we read before the update time limit, do not update
-	if p.lastRead.Add(PzemUpdateTime * time.Millisecond).After(time.Now()) {
+	if p.lastRead.Add(p.interval).After(time.Now()) {
 		return nil
 	}
 
-	// Read 10 registers starting at 0x00 (no check)
-	if err := p.sendCmd8(ReadInputRegister, 0x00, 0x0A, false); err != nil {
+	defer p.acquire()()
+
+	return p.retry(p.readValues)
+}
+
+// retry runs a transaction again while it fails on a CRC, short read or
+// timeout, up to the configured number of retries. With ReconnectOnError, a
+// transaction failing on the port runs once more on a reopened port.
+func (p *pzem) retry(tx func() error) error {
+	err := tx()
+	if errors.As(err, new(portError)) && p.autoReopen && p.reopen != nil {
+		if rerr := p.reconnect(err); rerr != nil {
+			return fmt.Errorf("%v, then reconnection failed: %w", err, rerr)
+		}
+		err = tx()
+	}
+	n := 0
+	for ; n < p.retries && (errors.Is(err, ErrCRC) || errors.Is(err, ErrShortRead) || errors.Is(err, ErrTimeout)); n++ {
+		time.Sleep(p.retryDelay)
+		err = tx()
+	}
+
+	if err != nil && n > 0 {
+		return fmt.Errorf("transaction failed after %d retries: %w", n, err)
+	}
+	return err
+}
+
+// readValues reads all the input registers from the device, ignoring the cache
+func (p *pzem) readValues() error {
+	count := acRegisters
+	if p.model == DC017 {
+		count = dcRegisters
+	}
+	response := make([]uint8, 5+2*count) // addr, cmd, byte count, registers, CRC
+
+	// Read all registers starting at 0x00 (no check)
+	if err := p.sendCmd8(ReadInputRegister, 0x00, uint16(count), false); err != nil {
 		return err
 	}
 
@@ -203,7 +752,52 @@ func (p *pzem) updateValues() error {
 		return err
 	}
 
+	if err := p.checkReply(response, ReadInputRegister, 2*count); err != nil {
+		return err
+	}
+
+	if p.bounds != nil { // Check the values before they replace the cached ones
+		v := pzem{model: p.model}
+		v.decode(response)
+		if err := p.plausible(&v); err != nil {
+			return err
+		}
+	}
+
+	// Track identical frames, a live meter almost never repeats itself
+	if raw := response[3 : 3+2*count]; bytes.Equal(p.registers, raw) {
+		p.identical++
+	} else {
+		p.registers = append(p.registers[:0], raw...)
+		p.identical = 1
+	}
+
 	// Update the current values
+	p.decode(response)
+
+	p.lastRead = time.Now()
+	p.valuesAt = p.lastRead
+
+	if p.debug {
+		p.logger.Debugf("pzem 0x%.2x decoded %v", p.addr, p.snapshot())
+	}
+
+	return nil
+}
+
+// decode updates the values from a read reply, according to the model
+func (p *pzem) decode(response []uint8) {
+	if p.model == DC017 {
+		p.decodeDC(response)
+	} else {
+		p.decodeAC(response)
+	}
+}
+
+// decodeAC decodes a PZEM-004T reply. 32-bit values span two registers, low
+// word first, so their bytes come as: low word high byte, low word low byte,
+// high word high byte, high word low byte.
+func (p *pzem) decodeAC(response []uint8) {
 	p.voltage = float32(uint32(response[3])<<8| // Raw voltage in 0.1V
 		uint32(response[4])) / 10.0
 
@@ -217,10 +811,10 @@ func (p *pzem) updateValues() error {
 		uint32(response[11])<<24|
 		uint32(response[12])<<16) / 10.0
 
-	p.energy = float32(uint32(response[13])<<8| // Raw Energy in 1Wh
-		uint32(response[14])|
-		uint32(response[15])<<24|
-		uint32(response[16])<<16) / 1000.0
+	p.energy = float32(uint32(response[13])<<8 | // Raw Energy in 1Wh
+		uint32(response[14]) |
+		uint32(response[15])<<24 |
+		uint32(response[16])<<16)
 
 	p.frequeny = float32(uint32(response[17])<<8| // Raw Frequency in 0.1Hz
 		uint32(response[18])) / 10.0
@@ -230,52 +824,218 @@ func (p *pzem) updateValues() error {
 
 	p.alarms = uint16(uint32(response[21])<<8 | // Raw alarm value
 		uint32(response[22]))
+}
 
-	p.lastRead = time.Now()
+// decodeDC decodes a PZEM-017 reply, with the same word order as decodeAC
+func (p *pzem) decodeDC(response []uint8) {
+	p.voltage = float32(uint32(response[3])<<8| // Raw voltage in 0.01V
+		uint32(response[4])) / 100.0
 
-	return nil
+	p.current = float32(uint32(response[5])<<8| // Raw current in 0.01A
+		uint32(response[6])) / 100.0
+
+	p.power = float32(uint32(response[7])<<8| // Raw power in 0.1W
+		uint32(response[8])|
+		uint32(response[9])<<24|
+		uint32(response[10])<<16) / 10.0
+
+	p.energy = float32(uint32(response[11])<<8 | // Raw Energy in 1Wh
+		uint32(response[12]) |
+		uint32(response[13])<<24 |
+		uint32(response[14])<<16)
+
+	p.alarms = uint16(uint32(response[15])<<8 | // Raw high voltage alarm value
+		uint32(response[16]))
+
+	p.lowAlarm = uint16(uint32(response[17])<<8 | // Raw low voltage alarm value
+		uint32(response[18]))
 }
 
+// isError returns the exception of an exception reply, whatever the command
+// (e.g. 0x84 for ReadInputRegister, 0x86 for WriteSingleRegister, 0xC2 for
+// ResetEnergy)
 func isError(buf []uint8) error {
-	if buf[1] == 0x84 {
+	if buf[1]&0x80 != 0 {
+		var err error
 		switch buf[2] {
 		case 0x01:
-			return errors.New("Illegal command")
+			err = ErrIllegalCommand
 		case 0x02:
-			return errors.New("Illegal address")
+			err = ErrIllegalAddress
 		case 0x03:
-			return errors.New("Illegal data")
+			err = ErrIllegalData
 		case 0x04:
-			return errors.New("Slave error")
+			err = ErrSlaveError
 		default:
-			return errors.New("Unknown error")
+			err = ErrUnknownException
 		}
+		return fmt.Errorf("exception 0x%.2x on command 0x%.2x: %w", buf[2], buf[1]&0x7F, err)
+	}
+	return nil
+}
 
+// write sends a frame to the device, after dropping any stale input such as
+// the end of a reply that came after its read timed out
+func (p *pzem) write(buf []uint8) error {
+	if p.port == nil {
+		return ErrNotConnected
+	}
+
+	p.flush()
+
+	n, err := p.port.Write(buf)
+	if err != nil {
+		return portError{"write", err}
+	}
+	p.logFrame(TX, buf[:n])
+	p.stats.Transactions++
+	if n < len(buf) {
+		return fmt.Errorf("try to send %d, but %d sent", len(buf), n)
 	}
 	return nil
 }
 
+// reconnect replaces the port with a newly opened one after cause. The
+// OnReconnect hook runs in its own goroutine, as the transaction lock is held.
+func (p *pzem) reconnect(cause error) error {
+	if err := p.reopenLocked(); err != nil {
+		return err
+	}
+
+	if p.onReconnect != nil {
+		go p.onReconnect(cause)
+	}
+	return nil
+}
+
+// reopenLocked closes the port and opens it again
+func (p *pzem) reopenLocked() error {
+	if p.port != nil {
+		p.port.Close()
+	}
+
+	port, err := p.reopen()
+	if err != nil {
+		return err
+	}
+	p.port = port
+	return nil
+}
+
+// flush discards pending input when the transport supports it
+func (p *pzem) flush() {
+	if f, ok := p.port.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+}
+
+// replyTimeout returns how long to wait for a reply of the given size
+func (p *pzem) replyTimeout(bytes int) time.Duration {
+	if !p.adaptive {
+		return p.timeout
+	}
+	if d := p.frameDuration(bytes) + replyMargin; d > p.timeout {
+		return d
+	}
+	return p.timeout
+}
+
+// readFull reads until buf is full, an exception reply is complete or the
+// read times out. It returns the number of bytes read.
+func (p *pzem) readFull(buf []uint8) (int, error) {
+	if p.port == nil {
+		return 0, ErrNotConnected
+	}
+
+	var deadline time.Time
+	if timeout := p.replyTimeout(len(buf)); timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+
+	n := 0
+	for n < len(buf) {
+		m, err := p.port.Read(buf[n:])
+		n += m
+		if err != nil && err != io.EOF {
+			return n, portError{"read", err}
+		}
+		if m == 0 || err == io.EOF { // Nothing came before the read timeout
+			if !p.adaptive || deadline.IsZero() || time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(p.frameDuration(1)) // The reply may still come
+			continue
+		}
+		if n >= 5 && buf[1]&0x80 != 0 { // Exception reply: addr, cmd|0x80, code, CRC
+			break
+		}
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			break
+		}
+	}
+
+	p.logFrame(RX, buf[:n])
+	return n, nil
+}
+
 func (p *pzem) recieve(resp []uint8) error {
-	n, err := p.port.Read(resp)
+	n, err := p.readFull(resp)
 	if err != nil {
 		return err
 	}
 
+	if p.maxGarbage > 0 && p.addr != PzemDefaultAddress {
+		if n, err = p.resync(resp, n); err != nil {
+			return err
+		}
+	}
+
+	// An exception reply is 5 bytes: addr, cmd|0x80, code, CRC
+	if n == 5 && resp[1]&0x80 != 0 && len(resp) > 5 {
+		if !checkCRC(resp[:5]) {
+			p.stats.CRCErrors++
+			return ErrCRC
+		}
+		if err := isError(resp[:5]); err != nil {
+			p.stats.Exceptions++
+			return err
+		}
+	}
+
 	if n != len(resp) {
-		return errors.Errorf("should got %d, but %d recieved", len(resp), n)
+		return p.shortRead(len(resp), n)
 	}
 
 	if !checkCRC(resp) {
-		return errors.New("recieved CRC is not valid")
+		p.stats.CRCErrors++
+		return ErrCRC
 	}
 
 	if err := isError(resp); err != nil {
+		p.stats.Exceptions++
 		return err
 	}
 
 	return nil
 }
 
+// resync drops up to maxGarbage bytes received before the slave address and
+// reads the rest of the frame. It returns the number of valid bytes in resp.
+func (p *pzem) resync(resp []uint8, n int) (int, error) {
+	i := bytes.IndexByte(resp[:n], p.addr)
+	if i <= 0 || i > p.maxGarbage { // Frame is aligned, or too much garbage
+		return n, nil
+	}
+
+	n = copy(resp, resp[i:n])
+	end := len(resp)
+	if n >= 2 && resp[1]&0x80 != 0 && end > 5 { // Exception reply
+		end = 5
+	}
+	m, err := p.readFull(resp[n:end]) // Gives up at the read timeout like any read
+	return n + m, err
+}
+
 func checkCRC(buf []uint8) bool {
 	l := len(buf)
 	if l <= 2 {
@@ -297,62 +1057,622 @@ func setCRC(buf []uint8) {
 }
 
 func (p *pzem) ResetEnergy() error {
+	if p.readOnly {
+		return ErrWritesDisabled
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	defer p.acquire()()
+
+	return p.resetEnergy(p.addr)
+}
+
+func (p *pzem) resetEnergy(addr uint8) error {
+	if p.closed {
+		return ErrClosed
+	}
+
 	buffer := []uint8{0x00, uint8(ResetEnergy), 0x00, 0x00}
-	reply := make([]uint8, 4)
-	buffer[0] = p.addr
+	reply := make([]uint8, 5) // Echo of the request, or a 5 bytes exception
+	buffer[0] = addr
 
 	setCRC(buffer)
 
-	p.port.Write(buffer)
+	if err := p.write(buffer); err != nil {
+		return err
+	}
 
-	time.Sleep(400 * time.Millisecond)
+	time.Sleep(p.turnaround)
 
-	err := p.recieve(reply)
+	n, err := p.readFull(reply[:4])
 	if err != nil {
 		return err
 	}
+	if n == 4 && reply[1]&0x80 != 0 { // Exception reply, read its last byte
+		m, err := p.readFull(reply[4:])
+		if err != nil {
+			return err
+		}
+		if n += m; n == 5 && checkCRC(reply) {
+			p.stats.Exceptions++
+			return fmt.Errorf("energy reset rejected: %w", isError(reply))
+		}
+	}
+
+	if n != 4 {
+		return p.shortRead(4, n)
+	}
+	if !checkCRC(reply[:4]) {
+		p.stats.CRCErrors++
+		return ErrCRC
+	}
+
+	// Devices may answer the general address with their own
+	if (addr != PzemDefaultAddress && reply[0] != addr) || reply[1] != uint8(ResetEnergy) {
+		return fmt.Errorf("unexpected reply % x to energy reset of 0x%.2x", reply[:4], addr)
+	}
+
+	p.lastRead = time.Time{} // Cached energy is no longer valid
+	p.energy = 0
 
 	return nil
 }
 
-func (p *pzem) Voltage() (float32, error) {
-	if err := p.updateValues(); err != nil {
-		return 0.0, err
+// ResetAllEnergy resets the energy counter through the general address
+// PzemDefaultAddress, so every device on the bus gets it. Devices may reply at
+// the same time: a reply error does not mean the reset was ignored.
+func (p *pzem) ResetAllEnergy() error {
+	if p.readOnly {
+		return ErrWritesDisabled
 	}
-	return p.voltage, nil
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	defer p.acquire()()
+
+	return p.resetEnergy(PzemDefaultAddress)
 }
 
-func (p *pzem) Intensity() (float32, error) {
-	if err := p.updateValues(); err != nil {
-		return 0.0, err
+// Calibrate sends the calibration command through the general address
+// PzemDefaultAddress and waits PzemCalibrationTime for the device to complete
+// it.
+//
+// Calibration overwrites the factory calibration of every device receiving
+// it, and is only meant to be run with the reference load the manufacturer
+// specifies: run otherwise, the device measures wrong values until calibrated
+// again.
+// For that reason, it is refused unless the probe uses the default address,
+// which is expected to be done with a single device on the bus.
+func (p *pzem) Calibrate() error {
+	if p.readOnly {
+		return ErrWritesDisabled
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.addr != PzemDefaultAddress {
+		return fmt.Errorf("calibration requires a probe at the default address 0x%.2x, not 0x%.2x", PzemDefaultAddress, p.addr)
+	}
+
+	defer p.acquire()()
+
+	if p.closed {
+		return ErrClosed
 	}
-	return p.current, nil
+
+	buffer := []uint8{PzemDefaultAddress, uint8(Calibration), 0x37, 0x21, 0x00, 0x00} // 0x3721 is the password
+	reply := make([]uint8, len(buffer))
+
+	setCRC(buffer)
+
+	if err := p.write(buffer); err != nil {
+		return err
+	}
+
+	time.Sleep(PzemCalibrationTime)
+
+	if err := p.recieve(reply); err != nil {
+		return err
+	}
+
+	if !bytes.Equal(buffer, reply) {
+		return errors.New("response should be the same than the request")
+	}
+
+	p.lastRead = time.Time{} // Values read before calibration are off
+
+	return nil
 }
 
-func (p *pzem) Power() (float32, error) {
-	if err := p.updateValues(); err != nil {
-		return 0.0, err
+// GetAlarmThreshold reads the power alarm threshold from the device, in W.
+// DC meters have voltage alarm thresholds instead, it fails with
+// ErrUnsupported on them.
+func (p *pzem) GetAlarmThreshold() (uint16, error) {
+	if p.model == DC017 {
+		return 0, fmt.Errorf("power alarm threshold: %w", ErrUnsupported)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	defer p.acquire()()
+
+	var threshold uint16
+	err := p.retry(func() (err error) {
+		threshold, err = p.readRegister(ReadHoldingRegister, AlarmThrhreshold)
+		return err
+	})
+	return threshold, err
+}
+
+// GetSlaveAddress reads the Modbus address stored in the device. On a probe
+// set up with the default address PzemDefaultAddress, this finds out the
+// address of an unknown device, provided it is alone on the bus.
+func (p *pzem) GetSlaveAddress() (uint8, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	defer p.acquire()()
+
+	var addr uint16
+	err := p.retry(func() (err error) {
+		addr, err = p.readRegister(ReadHoldingRegister, ModbusRTUAddress)
+		return err
+	})
+	return uint8(addr), err
+}
+
+// DeviceConfig is the configuration stored in the device
+type DeviceConfig struct {
+	AlarmThresholdWatts uint16
+	Address             uint8
+}
+
+// GetConfig reads the alarm threshold and the address of the device in a
+// single transaction. DC meters have voltage alarm thresholds instead, it
+// fails with ErrUnsupported on them.
+func (p *pzem) GetConfig() (DeviceConfig, error) {
+	if p.model == DC017 {
+		return DeviceConfig{}, fmt.Errorf("device config: %w", ErrUnsupported)
 	}
-	return p.power, nil
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	defer p.acquire()()
+
+	var regs []uint16
+	err := p.retry(func() (err error) {
+		regs, err = p.readRegisters(ReadHoldingRegister, AlarmThrhreshold, 2) // Threshold, then address
+		return err
+	})
+	if err != nil {
+		return DeviceConfig{}, err
+	}
+	return DeviceConfig{AlarmThresholdWatts: regs[0], Address: uint8(regs[1])}, nil
 }
 
-func (p *pzem) Energy() (float32, error) {
-	if err := p.updateValues(); err != nil {
+// Ping checks the device answers, with a single read of one register. It
+// bypasses the cache and leaves it untouched.
+func (p *pzem) Ping() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	defer p.acquire()()
+
+	_, err := p.readRegister(ReadInputRegister, Voltage)
+	return err
+}
+
+// ChangeBaud reopens the serial port at speed, once the device has been
+// configured for it, and pings the device. When it does not answer, the port
+// is reopened at the previous speed and the error returned. The address and
+// the other settings are kept.
+func (p *pzem) ChangeBaud(speed int) error {
+	if !supportedSpeed(p.model, speed) {
+		return fmt.Errorf("unsupported speed %d, the device supports %v", speed, speeds[p.model])
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return ErrClosed
+	}
+	if p.reopen == nil {
+		return fmt.Errorf("change baud: %w", ErrUnsupported)
+	}
+
+	defer p.acquire()()
+
+	previous := p.speed
+	p.setSpeed(speed)
+	err := p.reopenLocked()
+	if err == nil {
+		if _, err = p.readRegister(ReadInputRegister, Voltage); err == nil {
+			return nil
+		}
+	}
+
+	p.setSpeed(previous)
+	if rerr := p.reopenLocked(); rerr != nil {
+		return fmt.Errorf("%v, then reopening at %d failed: %w", err, previous, rerr)
+	}
+	return fmt.Errorf("changing to %d failed: %w", speed, err)
+}
+
+// ReadAndResetEnergy reads the energy counter, bypassing the cache, and
+// resets it right after. It returns the energy read, in the same unit as
+// Energy().
+func (p *pzem) ReadAndResetEnergy() (float32, error) {
+	if p.readOnly {
+		return 0.0, ErrWritesDisabled
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	defer p.acquire()()
+
+	if err := p.retry(p.readValues); err != nil {
+		return 0.0, err
+	}
+	energy := p.energy
+
+	if err := p.resetEnergy(p.addr); err != nil {
 		return 0.0, err
 	}
-	return p.energy, nil
+
+	return energy, nil
+}
+
+func (p *pzem) Voltage() (float32, error) {
+	m, err := p.ReadAll()
+	return m.Voltage, err
+}
+
+func (p *pzem) Intensity() (float32, error) {
+	m, err := p.ReadAll()
+	return m.Current, err
+}
+
+func (p *pzem) Power() (float32, error) {
+	m, err := p.ReadAll()
+	return m.Power, err
+}
+
+// Energy returns the energy counter in Wh
+func (p *pzem) Energy() (float32, error) {
+	m, err := p.ReadAll()
+	return m.Energy, err
+}
+
+// EnergyKWh returns the energy counter in kWh
+func (p *pzem) EnergyKWh() (float32, error) {
+	energy, err := p.Energy()
+	return energy / 1000.0, err
 }
 
 func (p *pzem) Frequency() (float32, error) {
-	if err := p.updateValues(); err != nil {
-		return 0.0, err
+	if p.model == DC017 {
+		return 0.0, fmt.Errorf("frequency: %w", ErrUnsupported)
 	}
-	return p.frequeny, nil
+	m, err := p.ReadAll()
+	return m.Frequency, err
 }
 
 func (p *pzem) PowerFactor() (float32, error) {
+	if p.model == DC017 {
+		return 0.0, fmt.Errorf("power factor: %w", ErrUnsupported)
+	}
+	m, err := p.ReadAll()
+	return m.PowerFactor, err
+}
+
+// Alarm reports whether the power is over the alarm threshold. On DC meters,
+// it reports whether either the high or the low voltage alarm is raised.
+func (p *pzem) Alarm() (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
 	if err := p.updateValues(); err != nil {
-		return 0.0, err
+		return false, err
+	}
+
+	alarm, err := alarmStatus(p.alarms)
+	if err != nil || p.model != DC017 {
+		return alarm, err
+	}
+
+	low, err := alarmStatus(p.lowAlarm)
+	return alarm || low, err
+}
+
+func alarmStatus(raw uint16) (bool, error) {
+	switch raw {
+	case 0xFFFF:
+		return true, nil
+	case 0x0000:
+		return false, nil
+	default:
+		return false, fmt.Errorf("unexpected alarm status 0x%.4x", raw)
+	}
+}
+
+// SetShunt writes the shunt rating of a DC meter, one of the Shunt constants
+func (p *pzem) SetShunt(value uint16) error {
+	if p.model != DC017 {
+		return fmt.Errorf("shunt: %w", ErrUnsupported)
+	}
+	if p.readOnly {
+		return ErrWritesDisabled
+	}
+	if value > Shunt300A {
+		return fmt.Errorf("unknown shunt value 0x%.4x", value)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	defer p.acquire()()
+
+	return p.sendCmd8(WriteSingleRegister, CurrentRange, value, true)
+}
+
+// WaitForEnergy blocks until the energy counter increased by at least deltaWh
+// since the call, or until ctx is done. A counter reset while waiting takes the
+// new value as baseline.
+func (p *pzem) WaitForEnergy(ctx context.Context, deltaWh float32) error {
+	base, err := p.Energy()
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	interval := p.interval
+	p.mu.Unlock()
+	if interval <= 0 { // No cache, poll at the default rate
+		interval = PzemUpdateTime * time.Millisecond
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+
+		energy, err := p.Energy()
+		if err != nil {
+			return err
+		}
+
+		if energy < base { // Counter has been reset, start again from there
+			base = energy
+			continue
+		}
+
+		if energy-base >= deltaWh {
+			return nil
+		}
+	}
+}
+
+// FrameDuration returns the time needed to transmit the given number of bytes
+// at the configured baud rate
+func (p *pzem) FrameDuration(bytes int) time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.frameDuration(bytes)
+}
+
+// frameDuration is FrameDuration for callers holding the probe lock
+func (p *pzem) frameDuration(bytes int) time.Duration {
+	if p.speed <= 0 {
+		return 0
+	}
+	return time.Duration(bytes*p.frameBits) * time.Second / time.Duration(p.speed)
+}
+
+// Frozen reports whether the device returned the same registers for at least
+// FrozenThreshold successive reads
+func (p *pzem) Frozen() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.frozenLimit > 0 && p.identical >= p.frozenLimit
+}
+
+// replyLength returns the expected length of the reply to a request frame
+func replyLength(request []byte) (int, error) {
+	if len(request) < 4 {
+		return 0, fmt.Errorf("request too short: %d bytes", len(request))
 	}
-	return p.powerFactor, nil
+
+	switch Command(request[1]) {
+	case ReadHoldingRegister, ReadInputRegister:
+		if len(request) != 8 {
+			return 0, fmt.Errorf("read request should be 8 bytes, got %d", len(request))
+		}
+		count := int(request[4])<<8 | int(request[5])
+		return 5 + 2*count, nil // addr, cmd, byte count, registers, CRC
+	case WriteSingleRegister:
+		return 8, nil // echo of the request
+	case Calibration, ResetEnergy:
+		return len(request), nil // echo of the request
+	default:
+		return 0, fmt.Errorf("unsupported command 0x%.2x", request[1])
+	}
+}
+
+// TransactRaw sends a complete request frame (CRC included) and returns the
+// reply frame as received. Only the reply length is checked: CRC and
+// exceptions are left to the caller. Writes and energy resets invalidate the
+// cache, and an acknowledged change of the address of the probe is followed.
+// Calibration is refused, use Calibrate.
+func (p *pzem) TransactRaw(request []byte) ([]byte, error) {
+	l, err := replyLength(request)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := Command(request[1])
+	if cmd == Calibration {
+		return nil, errors.New("calibration is not supported by TransactRaw, use Calibrate")
+	}
+
+	if p.readOnly && cmd != ReadHoldingRegister && cmd != ReadInputRegister {
+		return nil, ErrWritesDisabled
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil, ErrClosed
+	}
+
+	defer p.acquire()()
+
+	if err := p.write(request); err != nil {
+		return nil, err
+	}
+	if cmd == WriteSingleRegister || cmd == ResetEnergy {
+		p.lastRead = time.Time{} // The device may have changed, even without a reply
+	}
+
+	time.Sleep(p.turnaround)
+
+	// Read the command first: an exception reply is 5 bytes (addr, cmd|0x80,
+	// code, CRC), longer than the 4 bytes echo of an energy reset
+	reply := make([]byte, l+5)
+	n, err := p.readFull(reply[:2])
+	if err == nil && n == 2 {
+		end := l
+		if reply[1]&0x80 != 0 {
+			end = 5
+		}
+		var m int
+		m, err = p.readFull(reply[2:end])
+		n += m
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if n == 5 && reply[1]&0x80 != 0 {
+		p.stats.Exceptions++
+	} else if n != l {
+		return nil, p.shortRead(l, n)
+	}
+
+	// The device echoes an address change it applied
+	if cmd == WriteSingleRegister && request[0] == p.addr && bytes.Equal(reply[:n], request) &&
+		Register(request[2])<<8|Register(request[3]) == ModbusRTUAddress {
+		p.addr = request[5]
+	}
+
+	return reply[:n], nil
+}
+
+// CacheExpiresIn returns the time left before cached values get stale and the
+// next read reaches the device
+func (p *pzem) CacheExpiresIn() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	d := time.Until(p.lastRead.Add(p.interval))
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// LastRead returns when the cached values were read from the device, the zero
+// time when no valid values are cached
+func (p *pzem) LastRead() time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.lastRead
+}
+
+// Age returns how long ago the cached values were read from the device. Check
+// LastRead() first, it is meaningless when no values are cached.
+func (p *pzem) Age() time.Duration {
+	return time.Since(p.LastRead())
+}
+
+// Close stops the goroutines of Stream, WatchAlarm and StartWatchdog, waits
+// for them to exit, then releases the serial port. Later reads and writes,
+// as well as a second Close(), return ErrClosed.
+func (p *pzem) Close() error {
+	p.mu.Lock()
+	if p.closed || p.port == nil {
+		p.mu.Unlock()
+		return ErrClosed
+	}
+	p.closed = true
+	if p.stop != nil {
+		close(p.stop)
+	}
+	p.mu.Unlock()
+
+	// Stop the streams and watchers before closing the port, they need the
+	// lock for their last transaction
+	p.workers.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.port.Close(); err != nil {
+		return fmt.Errorf("closing the port: %w", err)
+	}
+	return nil
+}
+
+// SetUpdateInterval changes the interval during which read values are cached,
+// 0 disables the cache
+func (p *pzem) SetUpdateInterval(d time.Duration) error {
+	if d < 0 {
+		return errors.New("update interval must not be negative")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.interval = d
+	return nil
+}
+
+// SetReadTimeout changes the read timeout. The serial port is reopened to
+// apply it, the previous timeout is kept if that fails. Transports enforce
+// their own timeout, only the wait for a whole reply changes.
+func (p *pzem) SetReadTimeout(d time.Duration) error {
+	if d <= 0 {
+		return errors.New("read timeout must be positive")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return ErrClosed
+	}
+
+	previous := p.timeout
+	p.timeout = d
+	if p.reopen == nil {
+		return nil
+	}
+
+	defer p.acquire()()
+
+	if err := p.reopenLocked(); err != nil {
+		p.timeout = previous
+		if rerr := p.reopenLocked(); rerr != nil {
+			return fmt.Errorf("%v, then reopening with the previous timeout failed: %w", err, rerr)
+		}
+		return err
+	}
+	return nil
 }
@@ -0,0 +1,160 @@
+package pzem_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/be-ys/pzem-004t-v3/crc16"
+	"github.com/be-ys/pzem-004t-v3/pzem"
+	"github.com/be-ys/pzem-004t-v3/pzem/pzemtest"
+)
+
+// setupFake returns a probe at address 1 of a fake device reporting m, with
+// values cached for an hour
+func setupFake(t *testing.T, m pzem.Measurement) (pzem.Probe, *pzemtest.FakeDevice) {
+	t.Helper()
+
+	d := pzemtest.NewFakeDevice(m)
+	p, err := pzem.SetupWithTransport(d, pzem.Config{SlaveArddress: 1, UpdateInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p, d
+}
+
+// withCRC appends the CRC to a frame
+func withCRC(frame ...byte) []byte {
+	crc := crc16.CRC(frame)
+	return append(frame, uint8(crc), uint8(crc>>8))
+}
+
+func TestGettersShareOneRead(t *testing.T) {
+	p, d := setupFake(t, pzem.Measurement{Voltage: 230.1, Current: 1.5, Power: 300, Energy: 42, Frequency: 50, PowerFactor: 0.87})
+	before := d.Requests()
+
+	getters := []func() (float32, error){p.Voltage, p.Intensity, p.Power, p.Energy, p.Frequency, p.PowerFactor}
+	for _, get := range getters {
+		if _, err := get(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := d.Requests() - before; n != 1 {
+		t.Errorf("six getters made %d requests, want 1", n)
+	}
+}
+
+func TestTransactRawResetInvalidatesCache(t *testing.T) {
+	p, _ := setupFake(t, pzem.Measurement{Voltage: 230, Energy: 1500})
+	if e, err := p.Energy(); err != nil || e != 1500 {
+		t.Fatalf("Energy() = %v, %v, want 1500", e, err)
+	}
+
+	if _, err := p.TransactRaw(withCRC(0x01, byte(pzem.ResetEnergy))); err != nil {
+		t.Fatal(err)
+	}
+	if e, err := p.Energy(); err != nil || e != 0 {
+		t.Errorf("Energy() after a raw reset = %v, %v, want 0", e, err)
+	}
+}
+
+func TestTransactRawFollowsAddressChange(t *testing.T) {
+	p, d := setupFake(t, pzem.Measurement{Voltage: 230})
+
+	if _, err := p.TransactRaw(pzem.BuildReadFrame(0x01, pzem.WriteSingleRegister, pzem.ModbusRTUAddress, 0x05)); err != nil {
+		t.Fatal(err)
+	}
+	if d.Address() != 0x05 {
+		t.Fatalf("device address is 0x%.2x, want 0x05", d.Address())
+	}
+	if err := p.Ping(); err != nil {
+		t.Errorf("Ping() at the new address: %v", err)
+	}
+}
+
+func TestTransactRawRefusesCalibration(t *testing.T) {
+	p, d := setupFake(t, pzem.Measurement{Voltage: 230})
+	before := d.Requests()
+
+	if _, err := p.TransactRaw(withCRC(0xF8, byte(pzem.Calibration), 0x37, 0x21)); err == nil {
+		t.Error("raw calibration did not fail")
+	}
+	if d.Requests() != before {
+		t.Error("raw calibration reached the device")
+	}
+}
+
+func TestAlarmThresholdUnsupportedOnDC(t *testing.T) {
+	d := pzemtest.NewFakeDevice(pzem.Measurement{Voltage: 48})
+	p, err := pzem.SetupWithTransport(d, pzem.Config{SlaveArddress: 1, Model: pzem.DC017})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := d.Requests()
+
+	if _, err := p.GetAlarmThreshold(); !errors.Is(err, pzem.ErrUnsupported) {
+		t.Errorf("GetAlarmThreshold() on DC = %v, want ErrUnsupported", err)
+	}
+	if _, err := p.GetConfig(); !errors.Is(err, pzem.ErrUnsupported) {
+		t.Errorf("GetConfig() on DC = %v, want ErrUnsupported", err)
+	}
+	if d.Requests() != before {
+		t.Error("reading the alarm threshold on DC reached the device")
+	}
+}
+
+func TestGetConfig(t *testing.T) {
+	p, _ := setupFake(t, pzem.Measurement{Voltage: 230})
+	if err := p.WriteRegister(pzem.AlarmThrhreshold, 2300); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := p.GetConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.AlarmThresholdWatts != 2300 || c.Address != 0x01 {
+		t.Errorf("GetConfig() = %+v, want a 2300W threshold at address 0x01", c)
+	}
+}
+
+func TestEnergyUnits(t *testing.T) {
+	// 70000Wh spans both energy registers: 0x1170 low, 0x0001 high
+	p, _ := setupFake(t, pzem.Measurement{Voltage: 230, Energy: 70000})
+
+	raw, err := p.ReadRaw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw.Registers[pzem.EnergyLow] != 0x1170 || raw.Registers[pzem.EnergyHight] != 0x0001 {
+		t.Fatalf("energy registers are 0x%.4x 0x%.4x, want 0x1170 0x0001",
+			raw.Registers[pzem.EnergyLow], raw.Registers[pzem.EnergyHight])
+	}
+
+	if e, err := p.Energy(); err != nil || e != 70000 {
+		t.Errorf("Energy() = %v, %v, want 70000 (Wh)", e, err)
+	}
+	if e, err := p.EnergyKWh(); err != nil || e != 70 {
+		t.Errorf("EnergyKWh() = %v, %v, want 70", e, err)
+	}
+}
+
+func TestTransactRawResetException(t *testing.T) {
+	p, d := setupFake(t, pzem.Measurement{Voltage: 230})
+
+	d.InjectException(0x04)
+	reply, err := p.TransactRaw(withCRC(0x01, byte(pzem.ResetEnergy)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := withCRC(0x01, byte(pzem.ResetEnergy)|0x80, 0x04); !bytes.Equal(reply, want) {
+		t.Errorf("TransactRaw() = % x, want the exception % x", reply, want)
+	}
+
+	// No byte of the exception is left for the next transaction
+	if err := p.Ping(); err != nil {
+		t.Errorf("Ping() after the exception = %v", err)
+	}
+}
@@ -0,0 +1,248 @@
+// Package pzemtest provides an in-memory PZEM device to test code using the
+// pzem package without hardware.
+package pzemtest
+
+import (
+	"errors"
+	"io"
+	"math"
+	"sync"
+
+	"github.com/be-ys/pzem-004t-v3/crc16"
+	"github.com/be-ys/pzem-004t-v3/pzem"
+)
+
+// DefaultAddress is the address of a new FakeDevice
+const DefaultAddress uint8 = 0x01
+
+// ErrClosed is returned when using a closed FakeDevice
+var ErrClosed = errors.New("fake device is closed")
+
+// FakeDevice is an in-memory PZEM-004T implementing io.ReadWriteCloser, to be
+// passed to pzem.SetupWithTransport. It answers requests sent to its address
+// or to the general address, and ignores frames with an invalid CRC, like the
+// real device. It is safe for concurrent use.
+type FakeDevice struct {
+	mu          sync.Mutex
+	addr        uint8
+	measurement pzem.Measurement
+	threshold   uint16
+	reply       []byte // Reply waiting to be read
+	crcErrors   int    // Number of next replies to corrupt
+	exception   uint8  // Exception code of the next reply, 0 for none
+	requests    int
+	closed      bool
+}
+
+// NewFakeDevice returns a device at DefaultAddress reporting m
+func NewFakeDevice(m pzem.Measurement) *FakeDevice {
+	return &FakeDevice{addr: DefaultAddress, measurement: m}
+}
+
+// SetMeasurement sets the values returned by the next reads
+func (d *FakeDevice) SetMeasurement(m pzem.Measurement) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.measurement = m
+}
+
+// Measurement returns the values currently reported
+func (d *FakeDevice) Measurement() pzem.Measurement {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.measurement
+}
+
+// Address returns the current address of the device
+func (d *FakeDevice) Address() uint8 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.addr
+}
+
+// InjectCRCErrors corrupts the CRC of the next n replies
+func (d *FakeDevice) InjectCRCErrors(n int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.crcErrors = n
+}
+
+// InjectException makes the next reply an exception frame with the given
+// code (0x01 illegal command, 0x02 illegal address, 0x03 illegal data,
+// 0x04 slave error)
+func (d *FakeDevice) InjectException(code uint8) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.exception = code
+}
+
+// Requests returns the number of valid requests received
+func (d *FakeDevice) Requests() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.requests
+}
+
+// Write receives a request frame and prepares the reply
+func (d *FakeDevice) Write(b []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return 0, ErrClosed
+	}
+
+	if len(b) < 4 || !validCRC(b) {
+		return len(b), nil // Garbage is ignored
+	}
+	if b[0] != d.addr && b[0] != pzem.PzemDefaultAddress {
+		return len(b), nil // Not for us
+	}
+	d.requests++
+
+	var reply []byte
+	if d.exception != 0 {
+		reply = exception(b, d.exception)
+		d.exception = 0
+	} else {
+		reply = d.handle(b)
+	}
+	if d.crcErrors > 0 {
+		reply[len(reply)-1] ^= 0xFF
+		d.crcErrors--
+	}
+	d.reply = reply
+
+	return len(b), nil
+}
+
+// Read returns the pending reply. Without one, it returns io.EOF like a
+// serial port whose read timed out.
+func (d *FakeDevice) Read(b []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return 0, ErrClosed
+	}
+	if len(d.reply) == 0 {
+		return 0, io.EOF
+	}
+
+	n := copy(b, d.reply)
+	d.reply = d.reply[n:]
+	return n, nil
+}
+
+// Close closes the device, later reads and writes fail with ErrClosed
+func (d *FakeDevice) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return ErrClosed
+	}
+	d.closed = true
+	return nil
+}
+
+// handle builds the reply to a valid request
+func (d *FakeDevice) handle(req []byte) []byte {
+	cmd := pzem.Command(req[1])
+	if len(req) != 8 && (cmd == pzem.ReadHoldingRegister || cmd == pzem.ReadInputRegister || cmd == pzem.WriteSingleRegister) {
+		return exception(req, 0x03)
+	}
+
+	switch cmd {
+	case pzem.ReadInputRegister:
+		return readReply(req, d.inputRegisters())
+	case pzem.ReadHoldingRegister:
+		return readReply(req, []uint16{0, d.threshold, uint16(d.addr)})
+	case pzem.WriteSingleRegister:
+		reg := pzem.Register(word(req[2:]))
+		value := word(req[4:])
+		switch {
+		case reg == pzem.AlarmThrhreshold:
+			d.threshold = value
+		case reg == pzem.ModbusRTUAddress && value >= 0x01 && value <= 0xF7:
+			d.addr = uint8(value)
+		default:
+			return exception(req, 0x03)
+		}
+		return append([]byte(nil), req...)
+	case pzem.ResetEnergy:
+		d.measurement.Energy = 0
+		return append([]byte(nil), req...)
+	case pzem.Calibration:
+		return append([]byte(nil), req...)
+	default:
+		return exception(req, 0x01)
+	}
+}
+
+// inputRegisters encodes the measurement as the device registers
+func (d *FakeDevice) inputRegisters() []uint16 {
+	m := d.measurement
+	current := scale(m.Current, 1000)
+	power := scale(m.Power, 10)
+	energy := scale(m.Energy, 1)
+	var alarm uint16
+	if m.Alarm {
+		alarm = 0xFFFF
+	}
+
+	return []uint16{
+		uint16(scale(m.Voltage, 10)),
+		uint16(current), uint16(current >> 16),
+		uint16(power), uint16(power >> 16),
+		uint16(energy), uint16(energy >> 16),
+		uint16(scale(m.Frequency, 10)),
+		uint16(scale(m.PowerFactor, 100)),
+		alarm,
+	}
+}
+
+// readReply answers a read of registers
+func readReply(req []byte, regs []uint16) []byte {
+	start, count := int(word(req[2:])), int(word(req[4:]))
+	if count == 0 || start+count > len(regs) {
+		return exception(req, 0x02)
+	}
+
+	reply := make([]byte, 5+2*count)
+	reply[0] = req[0]
+	reply[1] = req[1]
+	reply[2] = uint8(2 * count)
+	for i, r := range regs[start : start+count] {
+		reply[3+2*i] = uint8(r >> 8)
+		reply[4+2*i] = uint8(r)
+	}
+	setCRC(reply)
+	return reply
+}
+
+func exception(req []byte, code uint8) []byte {
+	reply := []byte{req[0], req[1] | 0x80, code, 0, 0}
+	setCRC(reply)
+	return reply
+}
+
+func scale(v float32, factor float64) uint32 {
+	return uint32(math.Round(float64(v) * factor))
+}
+
+func word(b []byte) uint16 {
+	return uint16(b[0])<<8 | uint16(b[1])
+}
+
+func validCRC(b []byte) bool {
+	l := len(b)
+	return crc16.CRC(b[:l-2]) == uint16(b[l-2])|uint16(b[l-1])<<8
+}
+
+func setCRC(b []byte) {
+	l := len(b)
+	crc := crc16.CRC(b[:l-2])
+	b[l-2] = uint8(crc)
+	b[l-1] = uint8(crc >> 8)
+}
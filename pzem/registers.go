@@ -0,0 +1,130 @@
+package pzem
+
+import "fmt"
+
+// MaxReadRegisters is the Modbus limit on the number of registers of a read
+const MaxReadRegisters = 125
+
+// ReadInputRegisters reads count input registers starting at start,
+// bypassing the cache
+func (p *pzem) ReadInputRegisters(start Register, count uint16) ([]uint16, error) {
+	return p.readRegistersTx(ReadInputRegister, start, count)
+}
+
+// ReadHoldingRegisters reads count holding registers starting at start
+func (p *pzem) ReadHoldingRegisters(start Register, count uint16) ([]uint16, error) {
+	return p.readRegistersTx(ReadHoldingRegister, start, count)
+}
+
+func (p *pzem) readRegistersTx(cmd Command, start Register, count uint16) ([]uint16, error) {
+	if count < 1 || count > MaxReadRegisters {
+		return nil, fmt.Errorf("register count %d is out of the 1-%d range", count, MaxReadRegisters)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	defer p.acquire()()
+
+	var regs []uint16
+	err := p.retry(func() (err error) {
+		regs, err = p.readRegisters(cmd, start, count)
+		return err
+	})
+	return regs, err
+}
+
+// readRegisters reads count registers with the given read command
+func (p *pzem) readRegisters(cmd Command, start Register, count uint16) ([]uint16, error) {
+	response := make([]uint8, 5+2*int(count)) // addr, cmd, byte count, registers, CRC
+
+	if err := p.sendCmd8(cmd, start, count, false); err != nil {
+		return nil, err
+	}
+
+	if err := p.recieve(response); err != nil {
+		return nil, err
+	}
+
+	if err := p.checkReply(response, cmd, 2*int(count)); err != nil {
+		return nil, err
+	}
+
+	regs := make([]uint16, count)
+	for i := range regs {
+		regs[i] = uint16(response[3+2*i])<<8 | uint16(response[4+2*i])
+	}
+	return regs, nil
+}
+
+// checkReply checks a read reply comes from the device, answers cmd and holds
+// the expected number of bytes. Devices may answer the general address with
+// their own.
+func (p *pzem) checkReply(response []uint8, cmd Command, bytes int) error {
+	switch {
+	case p.addr != PzemDefaultAddress && response[0] != p.addr:
+		return fmt.Errorf("reply from 0x%.2x instead of 0x%.2x: %w", response[0], p.addr, ErrMalformedFrame)
+	case response[1] != uint8(cmd):
+		return fmt.Errorf("reply to command 0x%.2x instead of 0x%.2x: %w", response[1], uint8(cmd), ErrMalformedFrame)
+	case int(response[2]) != bytes:
+		return fmt.Errorf("byte count %d instead of %d: %w", response[2], bytes, ErrMalformedFrame)
+	}
+	return nil
+}
+
+// WriteRegister writes a single holding register and checks the device echoed
+// the request. A write rejected by the device fails with the error of its
+// exception, ErrIllegalData for a value out of range. A write of
+// ModbusRTUAddress goes through SetAddress, so the probe follows the device.
+func (p *pzem) WriteRegister(reg Register, value uint16) error {
+	if p.readOnly {
+		return ErrWritesDisabled
+	}
+
+	if reg == ModbusRTUAddress {
+		if value > 0xFF {
+			return fmt.Errorf("address provided is incorrect: 0x%.4x is out of the 0x01-0xF7 range", value)
+		}
+		return p.setSlaveArddress(uint8(value))
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	defer p.acquire()()
+
+	return p.writeRegister(reg, value)
+}
+
+func (p *pzem) writeRegister(reg Register, value uint16) error {
+	if err := p.sendCmd8(WriteSingleRegister, reg, value, false); err != nil {
+		return err
+	}
+
+	reply := make([]uint8, 8) // Echo of the request
+	n, err := p.readFull(reply)
+	if err != nil {
+		return err
+	}
+
+	// An exception reply is 5 bytes: addr, cmd|0x80, code, CRC
+	if n == 5 && reply[1]&0x80 != 0 && checkCRC(reply[:5]) {
+		p.stats.Exceptions++
+		return fmt.Errorf("write of register 0x%.4x rejected: %w", uint16(reg), isError(reply[:5]))
+	}
+	if n != len(reply) {
+		return p.shortRead(len(reply), n)
+	}
+	if !checkCRC(reply) {
+		p.stats.CRCErrors++
+		return ErrCRC
+	}
+
+	if p.addr != PzemDefaultAddress && reply[0] != p.addr {
+		return fmt.Errorf("reply from 0x%.2x instead of 0x%.2x: %w", reply[0], p.addr, ErrMalformedFrame)
+	}
+	if reply[1] != uint8(WriteSingleRegister) ||
+		Register(reply[2])<<8|Register(reply[3]) != reg ||
+		uint16(reply[4])<<8|uint16(reply[5]) != value {
+		return fmt.Errorf("response should be the same than the request: %w", ErrMalformedFrame)
+	}
+	return nil
+}
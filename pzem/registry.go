@@ -0,0 +1,91 @@
+package pzem
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Registry keeps named probes on separate serial ports, and closes them all
+// at once. It is safe for concurrent use.
+type Registry struct {
+	mu     sync.Mutex
+	probes map[string]Probe
+	ports  map[string]string // Port name to probe name, set up probes included
+	closed bool
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{probes: map[string]Probe{}, ports: map[string]string{}}
+}
+
+// Add sets up a probe with config and registers it as name. It fails when the
+// name is taken or the port is already used by another probe of the registry.
+func (r *Registry) Add(name string, config Config) error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return ErrClosed
+	}
+	if _, ok := r.probes[name]; ok {
+		r.mu.Unlock()
+		return fmt.Errorf("probe %q already registered", name)
+	}
+	if other, ok := r.ports[config.Port]; ok {
+		r.mu.Unlock()
+		return fmt.Errorf("port %s already used by probe %q", config.Port, other)
+	}
+	r.ports[config.Port] = name // Reserved during the setup
+	r.mu.Unlock()
+
+	p, err := Setup(config)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err != nil {
+		delete(r.ports, config.Port)
+		return err
+	}
+	if r.closed || r.probes[name] != nil { // Closed, or added concurrently
+		delete(r.ports, config.Port)
+		p.Close()
+		if r.closed {
+			return ErrClosed
+		}
+		return fmt.Errorf("probe %q already registered", name)
+	}
+	r.probes[name] = p
+	return nil
+}
+
+// Get returns the probe registered as name
+func (r *Registry) Get(name string) (Probe, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p, ok := r.probes[name]
+	return p, ok
+}
+
+// Close closes every probe of the registry, which can no longer be used. It
+// returns the first error met, after closing them all.
+func (r *Registry) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return ErrClosed
+	}
+	r.closed = true
+
+	var first error
+	for name, p := range r.probes {
+		if err := p.Close(); err != nil && first == nil {
+			first = fmt.Errorf("closing probe %q: %w", name, err)
+		}
+	}
+	r.probes = map[string]Probe{}
+	r.ports = map[string]string{}
+	return first
+}
@@ -0,0 +1,86 @@
+package pzem
+
+import "sync"
+
+// Sampler averages the measurements of a probe over a window of recent reads.
+// It is safe for concurrent use.
+type Sampler struct {
+	mu      sync.Mutex
+	probe   Probe
+	samples []Measurement // Ring buffer
+	next    int           // Index of the next sample in samples
+	full    bool
+}
+
+// NewSampler creates a sampler averaging the last window reads of p. A window
+// below 1 is taken as 1.
+func NewSampler(p Probe, window int) *Sampler {
+	if window < 1 {
+		window = 1
+	}
+	return &Sampler{probe: p, samples: make([]Measurement, window)}
+}
+
+// Sample reads the probe and adds the measurement to the window. A failed read
+// is not added, its error is returned. Sampling more often than the update
+// interval of the probe adds the same cached values again.
+func (s *Sampler) Sample() error {
+	m, err := s.probe.ReadAll()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.samples[s.next] = m
+	s.next = (s.next + 1) % len(s.samples)
+	if s.next == 0 {
+		s.full = true
+	}
+	return nil
+}
+
+// Len returns the number of samples in the window
+func (s *Sampler) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.full {
+		return len(s.samples)
+	}
+	return s.next
+}
+
+// Average returns the mean voltage, current, power, frequency and power factor
+// over the window. Energy, alarms and time are those of the latest sample.
+// It returns a zero Measurement before the first sample.
+func (s *Sampler) Average() Measurement {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := s.next
+	if s.full {
+		n = len(s.samples)
+	}
+	if n == 0 {
+		return Measurement{}
+	}
+
+	avg := s.samples[(s.next+len(s.samples)-1)%len(s.samples)] // Latest
+	var voltage, current, power, frequency, powerFactor float64
+	for _, m := range s.samples[:n] {
+		voltage += float64(m.Voltage)
+		current += float64(m.Current)
+		power += float64(m.Power)
+		frequency += float64(m.Frequency)
+		powerFactor += float64(m.PowerFactor)
+	}
+	avg.Voltage = float32(voltage / float64(n))
+	avg.Current = float32(current / float64(n))
+	avg.Power = float32(power / float64(n))
+	avg.Frequency = float32(frequency / float64(n))
+	avg.PowerFactor = float32(powerFactor / float64(n))
+
+	return avg
+}
@@ -0,0 +1,17 @@
+package pzem_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/be-ys/pzem-004t-v3/pzem"
+)
+
+func TestFrameDuration(t *testing.T) {
+	p, _ := setupFake(t, pzem.Measurement{Voltage: 230})
+
+	// 8N1 at 9600 baud: 10 bits per byte
+	if d, want := p.FrameDuration(96), 100*time.Millisecond; d != want {
+		t.Errorf("FrameDuration(96) = %v, want %v", d, want)
+	}
+}
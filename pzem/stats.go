@@ -0,0 +1,32 @@
+package pzem
+
+import "fmt"
+
+// Stats counts the transactions of a probe and how they failed, to tell how
+// reliable the bus is
+type Stats struct {
+	Transactions uint64 // Requests sent to the device
+	CRCErrors    uint64 // Replies failing their CRC check
+	ShortReads   uint64 // Replies shorter than expected
+	Timeouts     uint64 // Requests left without any reply
+	Exceptions   uint64 // Exception replies
+}
+
+// Stats returns the counters since the probe was set up
+func (p *pzem) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.stats
+}
+
+// shortRead counts a reply of n bytes instead of l, and returns its error,
+// ErrTimeout when nothing was received
+func (p *pzem) shortRead(l, n int) error {
+	if n == 0 {
+		p.stats.Timeouts++
+		return fmt.Errorf("should got %d bytes: %w", l, ErrTimeout)
+	}
+	p.stats.ShortReads++
+	return fmt.Errorf("should got %d, but %d recieved: %w", l, n, ErrShortRead)
+}
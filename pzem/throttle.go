@@ -0,0 +1,17 @@
+package pzem
+
+import "time"
+
+// NewThrottled spaces the transactions of p by at least minInterval, like
+// Config.MinTransactionInterval, and returns p. The floor holds whatever method
+// issues them, polling ones such as Stream or WaitForEnergy included. Callers
+// block until the interval has elapsed. Probe implementations from other
+// packages have no transactions to space and are returned unchanged.
+func NewThrottled(p Probe, minInterval time.Duration) Probe {
+	if pz, ok := p.(*pzem); ok {
+		pz.mu.Lock()
+		pz.minGap = minInterval
+		pz.mu.Unlock()
+	}
+	return p
+}
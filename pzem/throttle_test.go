@@ -0,0 +1,31 @@
+package pzem_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/be-ys/pzem-004t-v3/pzem"
+	"github.com/be-ys/pzem-004t-v3/pzem/pzemtest"
+)
+
+func TestThrottledStream(t *testing.T) {
+	d := pzemtest.NewFakeDevice(pzem.Measurement{Voltage: 230})
+	p, err := pzem.SetupWithTransport(d, pzem.Config{SlaveArddress: 1, UpdateInterval: time.Nanosecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p = pzem.NewThrottled(p, 100*time.Millisecond)
+
+	before, start := d.Requests(), time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	for range p.Stream(ctx, 10*time.Millisecond) {
+	}
+	elapsed := time.Since(start) // Includes the transaction running at the end
+
+	// At most one transaction per 100ms, plus the one starting right away
+	if n, max := d.Requests()-before, int(elapsed/(100*time.Millisecond))+1; n > max {
+		t.Errorf("%d requests in %v, want at most %d", n, elapsed, max)
+	}
+}
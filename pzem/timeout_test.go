@@ -0,0 +1,33 @@
+package pzem
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDefaultTimeOut(t *testing.T) {
+	tests := []struct {
+		model DeviceModel
+		speed int
+		want  time.Duration
+	}{
+		{AC004T, 9600, 100 * time.Millisecond},
+		{DC017, 4800, 200 * time.Millisecond},
+		{DC017, 1200, 300 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		c := Config{Port: "/dev/null", Model: tt.model, Speed: tt.speed}
+		if err := c.check(); err != nil {
+			t.Fatal(err)
+		}
+		if c.TimeOut != tt.want {
+			t.Errorf("default TimeOut at %d bauds = %v, want %v", tt.speed, c.TimeOut, tt.want)
+		}
+	}
+
+	c := Config{TimeOut: -time.Second}
+	if err := c.check(); err == nil {
+		t.Error("negative TimeOut accepted")
+	}
+}
@@ -0,0 +1,74 @@
+package pzem
+
+// Vector is a raw register set and the values this library decodes from it
+type Vector struct {
+	Model       DeviceModel
+	Registers   []uint16
+	Voltage     float32
+	Current     float32
+	Power       float32
+	Energy      float32
+	Frequency   float32
+	PowerFactor float32
+	Alarms      uint16
+	// LowAlarm is the low voltage alarm of DC meters
+	LowAlarm uint16
+}
+
+// Register sets used to generate the vectors, 32-bit values are low word first
+var (
+	acVectorInputs = [][]uint16{
+		{0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+		{2301, 435, 0, 1001, 0, 1203, 0, 499, 98, 0x0000},
+		{2298, 0x2345, 0x0001, 0x8765, 0x0002, 0xFFFF, 0x00FF, 500, 100, 0xFFFF},
+		{0xFFFF, 0xFFFF, 0xFFFF, 0xFFFF, 0xFFFF, 0xFFFF, 0xFFFF, 0xFFFF, 0xFFFF, 0xFFFF},
+	}
+	dcVectorInputs = [][]uint16{
+		{0, 0, 0, 0, 0, 0, 0, 0},
+		{1250, 523, 654, 0, 12345, 0, 0x0000, 0x0000},
+		{4800, 10000, 0x5678, 0x0007, 0x4321, 0x0001, 0xFFFF, 0x0000},
+	}
+)
+
+// TestVectors returns representative register sets along with the values this
+// library decodes them to. Other implementations can use them to check they
+// decode identically.
+func TestVectors() []Vector {
+	var vectors []Vector
+	for _, regs := range acVectorInputs {
+		vectors = append(vectors, decodeVector(AC004T, regs))
+	}
+	for _, regs := range dcVectorInputs {
+		vectors = append(vectors, decodeVector(DC017, regs))
+	}
+	return vectors
+}
+
+func decodeVector(model DeviceModel, regs []uint16) Vector {
+	// Build the reply frame the device would send
+	frame := make([]uint8, 5+2*len(regs))
+	frame[0] = PzemDefaultAddress
+	frame[1] = uint8(ReadInputRegister)
+	frame[2] = uint8(2 * len(regs))
+	for i, r := range regs {
+		frame[3+2*i] = uint8(r >> 8)
+		frame[4+2*i] = uint8(r)
+	}
+	setCRC(frame)
+
+	p := &pzem{model: model}
+	p.decode(frame)
+
+	return Vector{
+		Model:       model,
+		Registers:   append([]uint16(nil), regs...),
+		Voltage:     p.voltage,
+		Current:     p.current,
+		Power:       p.power,
+		Energy:      p.energy,
+		Frequency:   p.frequeny,
+		PowerFactor: p.powerFactor,
+		Alarms:      p.alarms,
+		LowAlarm:    p.lowAlarm,
+	}
+}
@@ -0,0 +1,262 @@
+package pzem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// WatchAlarm polls the alarm every interval and sends its new state on the
+// returned channel each time it changes. A change is only reported once
+// AlarmDebounce successive reads agree on it, and failed reads are skipped.
+// The channel is closed when ctx is done or the probe is closed.
+func (p *pzem) WatchAlarm(ctx context.Context, interval time.Duration) (<-chan bool, error) {
+	if interval <= 0 {
+		return nil, errors.New("watch interval must be positive")
+	}
+
+	state, err := p.Alarm()
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan bool)
+	err = p.spawn(ctx, func(ctx context.Context) {
+		defer close(ch)
+
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		pending := 0 // Successive reads disagreeing with state
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+
+			alarm, err := p.Alarm()
+			if err != nil {
+				continue
+			}
+			if alarm == state {
+				pending = 0
+				continue
+			}
+			if pending++; pending < p.debounce {
+				continue
+			}
+
+			state, pending = alarm, 0
+			select {
+			case ch <- state:
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ch, nil
+}
+
+// Reading is a measurement sent by Stream or read by Bus.ReadAll, or the
+// error reading it
+type Reading struct {
+	Address     uint8 // Slave address of the device
+	Measurement Measurement
+	// Time is when the read completed, even a failed one
+	Time time.Time
+	Err  error
+}
+
+// Stream reads every interval and sends the results, errors included, on the
+// returned channel. The channel is closed when ctx is done or the probe is
+// closed. A non-positive interval reads at the update interval.
+func (p *pzem) Stream(ctx context.Context, interval time.Duration) <-chan Reading {
+	if interval <= 0 {
+		p.mu.Lock()
+		interval = p.interval
+		p.mu.Unlock()
+	}
+	if interval <= 0 { // No cache, poll at the default rate
+		interval = PzemUpdateTime * time.Millisecond
+	}
+
+	ch := make(chan Reading)
+	err := p.spawn(ctx, func(ctx context.Context) {
+		defer close(ch)
+
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+
+			m, err := p.ReadAll()
+			p.mu.Lock()
+			addr := p.addr
+			p.mu.Unlock()
+
+			select {
+			case ch <- Reading{Address: addr, Measurement: m, Time: time.Now(), Err: err}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+	if err != nil { // Closed probe, nothing to stream
+		close(ch)
+	}
+
+	return ch
+}
+
+// WatchdogState is a connection state reported by StartWatchdog
+type WatchdogState int
+
+const (
+	// Healthy is reported when the device answers again
+	Healthy WatchdogState = iota
+	// Unhealthy is reported after threshold successive failed pings
+	Unhealthy
+	// Reconnected is reported when the serial port has been reopened
+	Reconnected
+)
+
+func (s WatchdogState) String() string {
+	switch s {
+	case Healthy:
+		return "healthy"
+	case Unhealthy:
+		return "unhealthy"
+	case Reconnected:
+		return "reconnected"
+	default:
+		return "unknown"
+	}
+}
+
+// StartWatchdog pings the device every interval. After threshold successive
+// failures, it reports Unhealthy and reopens the serial port, reporting
+// Reconnected, until the device answers again and Healthy is reported. Probes
+// set up with a transport cannot be reopened and only report their health.
+// The channel is closed when ctx is done or the probe is closed.
+func (p *pzem) StartWatchdog(ctx context.Context, interval time.Duration, threshold int) (<-chan WatchdogState, error) {
+	if interval <= 0 {
+		return nil, errors.New("watch interval must be positive")
+	}
+	if threshold < 1 {
+		return nil, errors.New("watchdog threshold must be at least 1")
+	}
+
+	ch := make(chan WatchdogState)
+	err := p.spawn(ctx, func(ctx context.Context) {
+		defer close(ch)
+
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		state, failures := Healthy, 0
+		send := func(s WatchdogState) bool {
+			state = s
+			select {
+			case ch <- s:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+
+			err := p.Ping()
+			if err == nil {
+				failures = 0
+				if state != Healthy && !send(Healthy) {
+					return
+				}
+				continue
+			}
+
+			if failures++; failures < threshold {
+				continue
+			}
+			if state == Healthy && !send(Unhealthy) {
+				return
+			}
+			if p.reopenPort(err) == nil {
+				failures = 0
+				if !send(Reconnected) {
+					return
+				}
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ch, nil
+}
+
+// spawn runs f in a background goroutine. Its context is also cancelled by
+// Close, which waits for f to return before closing the port.
+func (p *pzem) spawn(ctx context.Context, f func(ctx context.Context)) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return ErrClosed
+	}
+	if p.stop == nil {
+		p.stop = make(chan struct{})
+	}
+	stop := p.stop
+
+	ctx, cancel := context.WithCancel(ctx)
+	p.workers.Add(1)
+	go func() {
+		defer p.workers.Done()
+		defer cancel()
+
+		go func() {
+			select {
+			case <-stop:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		f(ctx)
+	}()
+	return nil
+}
+
+// reopenPort reopens the serial port after cause, if the probe has one
+func (p *pzem) reopenPort(cause error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return ErrClosed
+	}
+	if p.reopen == nil {
+		return fmt.Errorf("reopen: %w", ErrUnsupported)
+	}
+
+	defer p.acquire()()
+
+	return p.reconnect(cause)
+}
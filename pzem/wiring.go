@@ -0,0 +1,59 @@
+package pzem
+
+import "math"
+
+const (
+	// WiringTolerance is the relative gap allowed between V×I×pf and the
+	// reported power before the wiring is considered suspicious
+	WiringTolerance = 0.1
+	// wiringMinPower is the absolute gap (W) always allowed, so that register
+	// rounding does not flag small loads
+	wiringMinPower = 1.0
+)
+
+// WiringReport is the result of a wiring plausibility check
+type WiringReport struct {
+	Voltage     float32
+	Current     float32
+	PowerFactor float32
+	// Expected power computed as V×I×pf
+	Expected float32
+	// Reported power read from the device
+	Reported float32
+	// Deviation of the reported power relative to the expected one
+	Deviation float32
+	// Consistent is false when the deviation exceeds WiringTolerance
+	Consistent bool
+}
+
+// WiringCheck reads a snapshot and checks that V×I×pf matches the power
+// reported by the device. The meter only reports magnitudes, so this is a
+// heuristic: a gross mismatch usually points to a badly installed current
+// clamp or a wiring mistake, but a consistent report does not prove the
+// installation right.
+func (p *pzem) WiringCheck() (WiringReport, error) {
+	m, err := p.ReadAll()
+	if err != nil {
+		return WiringReport{}, err
+	}
+
+	r := WiringReport{
+		Voltage:     m.Voltage,
+		Current:     m.Current,
+		PowerFactor: m.PowerFactor,
+		Reported:    m.Power,
+	}
+	if p.model == DC017 { // No power factor on DC
+		r.PowerFactor = 1.0
+	}
+	r.Expected = r.Voltage * r.Current * r.PowerFactor
+
+	diff := math.Abs(float64(r.Reported - r.Expected))
+	if r.Expected != 0 {
+		r.Deviation = float32(diff / float64(r.Expected))
+	}
+	r.Consistent = diff <= wiringMinPower ||
+		diff <= WiringTolerance*math.Max(float64(r.Expected), float64(r.Reported))
+
+	return r, nil
+}